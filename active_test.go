@@ -0,0 +1,47 @@
+package main
+
+import (
+	"testing"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+)
+
+// TestActiveTiles checks that every tile is computed in the first turn, that most of the 512x512 board
+// is skipped once it has settled, and that skipping tiles does not change the number of alive cells.
+func TestActiveTiles(t *testing.T) {
+	p := gol.Params{
+		Turns:       2000,
+		Threads:     8,
+		ImageWidth:  512,
+		ImageHeight: 512,
+	}
+	alive := readAliveCounts(p.ImageWidth, p.ImageHeight)
+	const tiles = 32 * 32
+
+	events := make(chan gol.Event)
+	gol.Run(p, events, nil)
+	var last gol.TileStats
+	for event := range events {
+		switch e := event.(type) {
+		case gol.TileStats:
+			if e.Computed+e.Skipped != tiles {
+				t.Fatalf("At turn %v computed %v and skipped %v tiles, expected %v in total", e.CompletedTurns, e.Computed, e.Skipped, tiles)
+			}
+			if e.CompletedTurns == 0 && e.Computed != tiles {
+				t.Errorf("Expected every tile to be computed in the first turn, computed %v", e.Computed)
+			}
+			last = e
+		case gol.FinalTurnComplete:
+			if len(e.Alive) != alive[p.Turns] {
+				t.Errorf("Expected %v alive cells after %v turns, got %v", alive[p.Turns], p.Turns, len(e.Alive))
+			}
+		}
+	}
+	if last.CompletedTurns != p.Turns-1 {
+		t.Fatalf("Expected a TileStats event for turn %v, the last was for turn %v", p.Turns-1, last.CompletedTurns)
+	}
+	t.Logf("Turn %v: computed %v, skipped %v", last.CompletedTurns, last.Computed, last.Skipped)
+	if last.Skipped < tiles/2 {
+		t.Errorf("Expected at least half of the tiles to be skipped after %v turns, skipped %v", p.Turns, last.Skipped)
+	}
+}
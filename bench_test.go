@@ -34,3 +34,94 @@ func Benchmark512x512(b *testing.B) {
 		})
 	}
 }
+
+// BenchmarkEngines compares the byte per cell and bit-packed backends on the same 512x512 world.
+func BenchmarkEngines(b *testing.B) {
+	for _, engine := range []gol.Engine{gol.Cells, gol.BitPacked} {
+		for _, threads := range []int{1, 2, 4, 8, 16} {
+			p := gol.Params{Turns: 100, Threads: threads, ImageWidth: 512, ImageHeight: 512, Engine: engine}
+			b.Run(fmt.Sprintf("%v-512x512-%v", engine, threads), func(b *testing.B) {
+				os.Stdout = nil // Disable all program output apart from benchmark results
+				for i := 0; i < b.N; i++ {
+					events := make(chan gol.Event)
+					b.StartTimer()
+					gol.Run(p, events, nil)
+					for range events {
+					}
+					b.StopTimer()
+				}
+			})
+		}
+	}
+}
+
+// BenchmarkDecompositions compares workers in strips and in a grid on a board much wider than it is tall.
+func BenchmarkDecompositions(b *testing.B) {
+	for _, decomposition := range []gol.Decomposition{gol.Strips, gol.Grid} {
+		for _, threads := range []int{4, 16} {
+			p := gol.Params{Turns: 100, Threads: threads, ImageWidth: 2048, ImageHeight: 24, Decomposition: decomposition}
+			b.Run(fmt.Sprintf("%v-2048x24-%v", decomposition, threads), func(b *testing.B) {
+				os.Stdout = nil // Disable all program output apart from benchmark results
+				for i := 0; i < b.N; i++ {
+					events := make(chan gol.Event)
+					b.StartTimer()
+					gol.Run(p, events, nil)
+					for range events {
+					}
+					b.StopTimer()
+				}
+			})
+		}
+	}
+}
+
+// BenchmarkTurnDiff compares a TurnDiff event per turn with a CellFlipped event per cell on the same 512x512 world,
+// drawing every flipped cell on a board like the viewer does.
+func BenchmarkTurnDiff(b *testing.B) {
+	for _, cellEvents := range []bool{false, true} {
+		for _, threads := range []int{1, 4, 16} {
+			p := gol.Params{Turns: 100, Threads: threads, ImageWidth: 512, ImageHeight: 512, CellEvents: cellEvents}
+			name := "TurnDiff"
+			if cellEvents {
+				name = "CellFlipped"
+			}
+			b.Run(fmt.Sprintf("%v-512x512-%v", name, threads), func(b *testing.B) {
+				os.Stdout = nil // Disable all program output apart from benchmark results
+				board := make([]uint8, p.ImageWidth*p.ImageHeight)
+				for i := 0; i < b.N; i++ {
+					events := make(chan gol.Event, 1000)
+					b.StartTimer()
+					gol.Run(p, events, nil)
+					for event := range events {
+						switch e := event.(type) {
+						case gol.CellFlipped:
+							board[e.Cell.Y*p.ImageWidth+e.Cell.X] = e.Value
+						case gol.TurnDiff:
+							for j, cell := range e.Cells {
+								board[cell.Y*p.ImageWidth+cell.X] = e.Values[j]
+							}
+						}
+					}
+					b.StopTimer()
+				}
+			})
+		}
+	}
+}
+
+// BenchmarkDistributorTurn runs b.N turns of the whole distributor loop on the 512x512 world, so that the time and
+// allocations per operation are those of a turn, including the events it sends. Loading the image is spread over the turns.
+func BenchmarkDistributorTurn(b *testing.B) {
+	for _, threads := range []int{1, 4, 16} {
+		b.Run(fmt.Sprintf("512x512-%v", threads), func(b *testing.B) {
+			os.Stdout = nil // Disable all program output apart from benchmark results
+			p := gol.Params{Turns: b.N, Threads: threads, ImageWidth: 512, ImageHeight: 512}
+			events := make(chan gol.Event, 1000)
+			b.ReportAllocs()
+			b.ResetTimer()
+			gol.Run(p, events, nil)
+			for range events {
+			}
+		})
+	}
+}
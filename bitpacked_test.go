@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// TestBitPacked runs the TestGol cases and the 123x45 image, and 100 turns of the other rules and topologies, with the BitPacked engine.
+func TestBitPacked(t *testing.T) {
+	type test struct {
+		p    gol.Params
+		path string
+	}
+	var tests []test
+	for _, size := range [][2]int{{16, 16}, {64, 64}, {512, 512}, {123, 45}} {
+		for _, turns := range []int{0, 1, 100} {
+			tests = append(tests, test{
+				gol.Params{ImageWidth: size[0], ImageHeight: size[1], Turns: turns},
+				fmt.Sprintf("check/images/%vx%vx%v.pgm", size[0], size[1], turns),
+			})
+		}
+	}
+	for _, ruleString := range []string{"B36S23", "B3678S34678", "B2S"} {
+		rule, err := gol.ParseRule(ruleString)
+		util.Check(err)
+		tests = append(tests, test{
+			gol.Params{ImageWidth: 64, ImageHeight: 64, Turns: 100, Rule: rule},
+			"check/images/rules/" + ruleString + "/64x64x100.pgm",
+		})
+	}
+	for _, topology := range []gol.Topology{gol.Plane, gol.HorizontalCylinder, gol.VerticalCylinder, gol.KleinBottle, gol.KleinBottleTwistedSides, gol.CrossSurface, gol.Sphere} {
+		tests = append(tests, test{
+			gol.Params{ImageWidth: 64, ImageHeight: 64, Turns: 100, Topology: topology},
+			fmt.Sprintf("check/images/topologies/%v/64x64x100.pgm", topology),
+		})
+	}
+
+	for _, test := range tests {
+		p := test.p
+		p.Engine = gol.BitPacked
+		expectedAlive := util.ReadAliveCells(test.path, p.ImageWidth, p.ImageHeight)
+		for _, threads := range []int{1, 3, 8} {
+			p.Threads = threads
+			testName := fmt.Sprintf("%v-%v-%dx%dx%d-%d", p.Rule, p.Topology, p.ImageWidth, p.ImageHeight, p.Turns, p.Threads)
+			t.Run(testName, func(t *testing.T) {
+				events := make(chan gol.Event)
+				gol.Run(p, events, nil)
+				var cells []util.Cell
+				for event := range events {
+					switch e := event.(type) {
+					case gol.FinalTurnComplete:
+						cells = e.Alive
+					}
+				}
+				assertEqualBoard(t, cells, expectedAlive, p)
+			})
+		}
+	}
+}
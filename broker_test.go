@@ -0,0 +1,154 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/rpc"
+	"os"
+	"testing"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// startBroker serves a broker and the given number of workers on loopback ports.
+// It returns the address of the broker and a function that closes all of their listeners.
+func startBroker(workers int) (string, func()) {
+	var listeners []net.Listener
+	var addresses []string
+	for i := 0; i < workers; i++ {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		util.Check(err)
+		go gol.ServeWorker(l)
+		listeners = append(listeners, l)
+		addresses = append(addresses, l.Addr().String())
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	util.Check(err)
+	go gol.ServeBroker(l, addresses)
+	listeners = append(listeners, l)
+	return l.Addr().String(), func() {
+		for _, l := range listeners {
+			l.Close()
+		}
+	}
+}
+
+// TestBroker runs the TestGol cases, a topology and a Generations rule on a broker with three workers.
+func TestBroker(t *testing.T) {
+	broker, stop := startBroker(3)
+	defer stop()
+
+	type test struct {
+		p    gol.Params
+		path string
+	}
+	var tests []test
+	for _, size := range []int{16, 64, 512} {
+		for _, turns := range []int{0, 1, 100} {
+			tests = append(tests, test{
+				gol.Params{ImageWidth: size, ImageHeight: size, Turns: turns},
+				fmt.Sprintf("check/images/%vx%vx%v.pgm", size, size, turns),
+			})
+		}
+	}
+	tests = append(tests, test{
+		gol.Params{ImageWidth: 64, ImageHeight: 64, Turns: 100, Topology: gol.KleinBottle},
+		"check/images/topologies/klein-bottle/64x64x100.pgm",
+	})
+	rule, err := gol.ParseRule("B2/S345/C4")
+	util.Check(err)
+	tests = append(tests, test{
+		gol.Params{ImageWidth: 64, ImageHeight: 64, Turns: 100, Rule: rule},
+		"check/images/rules/B2S345C4/64x64x100.pgm",
+	})
+
+	for _, test := range tests {
+		p := test.p
+		p.Broker = broker
+		expectedAlive := util.ReadAliveCells(test.path, p.ImageWidth, p.ImageHeight)
+		for _, threads := range []int{1, 4, 16} {
+			p.Threads = threads
+			testName := fmt.Sprintf("%v-%v-%dx%dx%d-%d", p.Rule, p.Topology, p.ImageWidth, p.ImageHeight, p.Turns, p.Threads)
+			t.Run(testName, func(t *testing.T) {
+				events := make(chan gol.Event)
+				gol.Run(p, events, nil)
+				var cells []util.Cell
+				for event := range events {
+					switch e := event.(type) {
+					case gol.FinalTurnComplete:
+						cells = e.Alive
+					}
+				}
+				assertEqualBoard(t, cells, expectedAlive, p)
+			})
+		}
+	}
+}
+
+// failingBroker is a broker that computes no cells and fails from the turn failAt.
+type failingBroker struct {
+	failAt int
+}
+
+func (b *failingBroker) Start(req gol.StartRequest, res *gol.StartResponse) error {
+	return nil
+}
+
+func (b *failingBroker) Step(req gol.StepRequest, res *gol.StepResponse) error {
+	if req.Turn >= b.failAt {
+		return errors.New("the broker lost its workers")
+	}
+	return nil
+}
+
+// TestBrokerLost checks that a run whose broker cannot be reached or fails a turn ends with a RunFailed event
+// and quits after writing the world reached, rather than panicking.
+func TestBrokerLost(t *testing.T) {
+	server := rpc.NewServer()
+	util.Check(server.RegisterName("Broker", &failingBroker{failAt: 3}))
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	util.Check(err)
+	defer l.Close()
+	go server.Accept(l)
+
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	util.Check(err)
+	closed.Close()
+
+	defer os.Remove("out/16x16x10.checkpoint.pgm")
+	for _, test := range []struct {
+		broker string
+		turn   int
+		output bool
+	}{
+		{closed.Addr().String(), 0, false},
+		{l.Addr().String(), 3, true},
+	} {
+		p := gol.Params{Turns: 10, Threads: 1, ImageWidth: 16, ImageHeight: 16, Broker: test.broker}
+		events := make(chan gol.Event)
+		gol.Run(p, events, nil)
+		var failed *gol.RunFailed
+		var output, last gol.Event
+		for event := range events {
+			switch e := event.(type) {
+			case gol.RunFailed:
+				failed = &e
+			case gol.ImageOutputComplete:
+				output = e
+				defer os.Remove("out/" + e.Filename + ".pgm")
+			}
+			last = event
+		}
+		if failed == nil || failed.CompletedTurns != test.turn {
+			t.Errorf("Expected the run on %v to fail at turn %v, got %v", test.broker, test.turn, failed)
+		}
+		if (output != nil) != test.output {
+			t.Errorf("Expected the world reached to be written out: %v, got %v", test.output, output)
+		}
+		if last != (gol.StateChange{CompletedTurns: test.turn, NewState: gol.Quitting}) {
+			t.Errorf("Expected the run to quit at turn %v, the last event was %v", test.turn, last)
+		}
+	}
+}
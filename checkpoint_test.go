@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// TestCheckpoint interrupts runs of 100 turns with 'k', which writes a checkpoint, resumes them from it
+// and checks that the turns carry on from where they stopped to the expected final board.
+// It also resumes from the checkpoints written every 30 turns by a run that was not interrupted.
+func TestCheckpoint(t *testing.T) {
+	for _, size := range []int{16, 64, 512} {
+		for _, threads := range []int{1, 4} {
+			p := gol.Params{
+				Turns:           100,
+				Threads:         threads,
+				ImageWidth:      size,
+				ImageHeight:     size,
+				CheckpointTurns: 30,
+			}
+			checkpoint := fmt.Sprintf("out/%vx%vx100.checkpoint.pgm", size, size)
+
+			t.Run(fmt.Sprintf("%dx%dx%d-interrupted", size, size, threads), func(t *testing.T) {
+				defer os.Remove(checkpoint)
+				events := make(chan gol.Event)
+				keyPresses := make(chan rune, 1)
+				gol.Run(p, events, keyPresses)
+				stoppedAt := -1
+				for event := range events {
+					switch e := event.(type) {
+					case gol.TurnComplete:
+						if e.CompletedTurns == 39 {
+							keyPresses <- 'k'
+						}
+					case gol.StateChange:
+						if e.NewState == gol.Quitting {
+							stoppedAt = e.CompletedTurns
+						}
+					case gol.ImageOutputComplete:
+						defer os.Remove("out/" + e.Filename + ".pgm")
+					}
+				}
+				if stoppedAt < 40 || stoppedAt >= 100 {
+					t.Fatalf("Expected the run to stop part of the way through, it stopped after %v turns", stoppedAt)
+				}
+				resume(t, p, checkpoint, stoppedAt)
+			})
+
+			t.Run(fmt.Sprintf("%dx%dx%d-periodic", size, size, threads), func(t *testing.T) {
+				defer os.Remove(checkpoint)
+				events := make(chan gol.Event)
+				gol.Run(p, events, nil)
+				for range events {
+				}
+				resume(t, p, checkpoint, 90)
+			})
+		}
+	}
+}
+
+// resume resumes the run p from a checkpoint, which must have completed the given number of turns,
+// and compares the final board with the expected one.
+func resume(t *testing.T, p gol.Params, checkpoint string, turns int) {
+	events := make(chan gol.Event)
+	gol.Run(gol.Params{Threads: p.Threads, Resume: checkpoint}, events, nil)
+	first := -1
+	var final gol.FinalTurnComplete
+	for event := range events {
+		switch e := event.(type) {
+		case gol.TurnComplete:
+			if first < 0 {
+				first = e.CompletedTurns
+			}
+		case gol.FinalTurnComplete:
+			final = e
+		}
+	}
+	if first != turns {
+		t.Fatalf("Expected the resumed run to start at turn %v, it started at turn %v", turns, first)
+	}
+	if final.CompletedTurns != 100 {
+		t.Fatalf("Expected the resumed run to complete 100 turns, it completed %v", final.CompletedTurns)
+	}
+	expected := util.ReadAliveCells(fmt.Sprintf("check/images/%vx%vx%v.pgm", p.ImageWidth, p.ImageHeight, p.Turns), p.ImageWidth, p.ImageHeight)
+	assertEqualBoard(t, final.Alive, expected, p)
+}
+
+// TestCheckpointExtend writes the checkpoints of a run of 60 turns next to its -out path, then resumes it
+// for 100 turns and checks that the final board is the one after 100 turns.
+func TestCheckpointExtend(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gol")
+	util.Check(err)
+	defer os.RemoveAll(dir)
+	p := gol.Params{Turns: 60, Threads: 4, ImageWidth: 64, ImageHeight: 64, CheckpointTurns: 30, Output: filepath.Join(dir, "board.pgm")}
+	events := make(chan gol.Event)
+	gol.Run(p, events, nil)
+	for range events {
+	}
+	checkpoint := filepath.Join(dir, "board.checkpoint.pgm")
+	if _, err := os.Stat(checkpoint); err != nil {
+		t.Fatalf("Expected the checkpoint next to the output: %v", err)
+	}
+	if _, err := os.Stat("out/64x64x60.checkpoint.pgm"); err == nil {
+		os.Remove("out/64x64x60.checkpoint.pgm")
+		t.Fatal("Expected no checkpoint in out/ with -out")
+	}
+
+	events = make(chan gol.Event)
+	gol.Run(gol.Params{Turns: 100, Threads: 4, Resume: checkpoint, Output: filepath.Join(dir, "extended.pgm")}, events, nil)
+	var final gol.FinalTurnComplete
+	for event := range events {
+		if e, ok := event.(gol.FinalTurnComplete); ok {
+			final = e
+		}
+	}
+	if final.CompletedTurns != 100 {
+		t.Fatalf("Expected the resumed run to complete 100 turns, it completed %v", final.CompletedTurns)
+	}
+	assertEqualBoard(t, final.Alive, util.ReadAliveCells("check/images/64x64x100.pgm", 64, 64), gol.Params{ImageWidth: 64, ImageHeight: 64})
+}
@@ -0,0 +1,42 @@
+// Command broker serves the broker of the distributed Game of Life, which takes the world of a controller
+// and computes its turns by splitting it into strips between worker processes.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+func main() {
+	address := flag.String(
+		"addr",
+		"127.0.0.1:8030",
+		"Specify the address to listen on. Defaults to 127.0.0.1:8030.")
+	workers := flag.String(
+		"workers",
+		"127.0.0.1:8031",
+		"Specify the comma separated addresses of the workers. Defaults to 127.0.0.1:8031.")
+	flag.Parse()
+
+	var addresses []string
+	for _, worker := range strings.Split(*workers, ",") {
+		if worker = strings.TrimSpace(worker); worker != "" {
+			addresses = append(addresses, worker)
+		}
+	}
+	if len(addresses) == 0 {
+		fmt.Fprintln(os.Stderr, "no worker addresses")
+		os.Exit(2)
+	}
+
+	l, err := net.Listen("tcp", *address)
+	util.Check(err)
+	fmt.Println("Broker listening on", l.Addr(), "with workers", addresses)
+	util.Check(gol.ServeBroker(l, addresses))
+}
@@ -0,0 +1,25 @@
+// Command worker serves a worker process of the distributed Game of Life, which computes strips of a world
+// for a broker or takes part in a peer-to-peer run.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+func main() {
+	address := flag.String(
+		"addr",
+		"127.0.0.1:8031",
+		"Specify the address to listen on. Defaults to 127.0.0.1:8031.")
+	flag.Parse()
+
+	l, err := net.Listen("tcp", *address)
+	util.Check(err)
+	fmt.Println("Worker listening on", l.Addr())
+	util.Check(gol.ServeWorker(l))
+}
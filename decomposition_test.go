@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// TestDecompositions tests square, non-square and very wide images, and the topologies, with the workers in strips and in grids.
+func TestDecompositions(t *testing.T) {
+	type test struct {
+		p    gol.Params
+		path string
+	}
+	var tests []test
+	for _, size := range [][2]int{{64, 64}, {500, 37}, {2048, 24}} {
+		for _, turns := range []int{1, 100} {
+			tests = append(tests, test{
+				gol.Params{ImageWidth: size[0], ImageHeight: size[1], Turns: turns},
+				fmt.Sprintf("check/images/%vx%vx%v.pgm", size[0], size[1], turns),
+			})
+		}
+	}
+	for _, topology := range []gol.Topology{gol.Plane, gol.HorizontalCylinder, gol.VerticalCylinder, gol.KleinBottle, gol.KleinBottleTwistedSides, gol.CrossSurface, gol.Sphere} {
+		tests = append(tests, test{
+			gol.Params{ImageWidth: 64, ImageHeight: 64, Turns: 100, Topology: topology},
+			fmt.Sprintf("check/images/topologies/%v/64x64x100.pgm", topology),
+		})
+	}
+
+	for _, test := range tests {
+		p := test.p
+		expectedAlive := util.ReadAliveCells(test.path, p.ImageWidth, p.ImageHeight)
+		for _, decomposition := range []gol.Decomposition{gol.AutoDecomposition, gol.Strips, gol.Grid} {
+			p.Decomposition = decomposition
+			for _, threads := range []int{1, 4, 6, 16, 48} {
+				p.Threads = threads
+				testName := fmt.Sprintf("%v-%dx%dx%d-%v-%d", p.Topology, p.ImageWidth, p.ImageHeight, p.Turns, p.Decomposition, p.Threads)
+				t.Run(testName, func(t *testing.T) {
+					events := make(chan gol.Event)
+					gol.Run(p, events, nil)
+					var cells []util.Cell
+					for event := range events {
+						switch e := event.(type) {
+						case gol.FinalTurnComplete:
+							cells = e.Alive
+						}
+					}
+					assertEqualBoard(t, cells, expectedAlive, p)
+				})
+			}
+		}
+	}
+}
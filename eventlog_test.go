@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"testing"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// replayAll replays a log as fast as possible from a turn and returns its events.
+func replayAll(t *testing.T, log *gol.EventLog, from int) []gol.Event {
+	events := make(chan gol.Event)
+	replayed := make(chan error, 1)
+	go func() { replayed <- log.Replay(events, nil, gol.ReplayOptions{From: from}) }()
+	var all []gol.Event
+	for event := range events {
+		all = append(all, event)
+	}
+	if err := <-replayed; err != nil {
+		t.Fatal(err)
+	}
+	return all
+}
+
+// boardAt applies the CellFlipped and TurnDiff events up to the TurnComplete event of a turn and returns the alive cells.
+func boardAt(events []gol.Event, turn int) []util.Cell {
+	board := make(map[util.Cell]bool)
+	for _, event := range events {
+		switch e := event.(type) {
+		case gol.CellFlipped:
+			board[e.Cell] = e.Value != 0
+		case gol.TurnDiff:
+			for i, cell := range e.Cells {
+				board[cell] = e.Values[i] != 0
+			}
+		case gol.TurnComplete:
+			if e.CompletedTurns == turn {
+				var cells []util.Cell
+				for cell, alive := range board {
+					if alive {
+						cells = append(cells, cell)
+					}
+				}
+				return cells
+			}
+		}
+	}
+	return nil
+}
+
+// TestEventLog logs 100 turns of the 64x64 image with a keyframe every 25 turns, replays the log from the start
+// and checks that the events are those of the run, then seeks to turn 60 and checks the board shown there.
+func TestEventLog(t *testing.T) {
+	p := gol.Params{Turns: 100, Threads: 4, ImageWidth: 64, ImageHeight: 64}
+	events := make(chan gol.Event)
+	forwarded := make(chan gol.Event)
+	var b bytes.Buffer
+	logged := make(chan error, 1)
+	go func() { logged <- gol.LogEvents(&b, p, events, forwarded, 25) }()
+	gol.Run(p, events, nil)
+	var run []gol.Event
+	for event := range forwarded {
+		run = append(run, event)
+	}
+	if err := <-logged; err != nil {
+		t.Fatal(err)
+	}
+
+	log, err := gol.OpenEventLog(bytes.NewReader(b.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if params := log.Params(); params.ImageWidth != 64 || params.Turns != 100 {
+		t.Fatalf("Expected the parameters of the run, got %v", params)
+	}
+	replayed := replayAll(t, log, 0)
+	if !reflect.DeepEqual(replayed, run) {
+		t.Fatalf("Expected the %v events of the run, got %v events", len(run), len(replayed))
+	}
+	size := gol.Params{ImageWidth: 64, ImageHeight: 64}
+	assertEqualBoard(t, boardAt(replayed, 99), util.ReadAliveCells("check/images/64x64x100.pgm", 64, 64), size)
+
+	seeked := replayAll(t, log, 60)
+	if diff, ok := seeked[0].(gol.TurnDiff); !ok || diff.CompletedTurns != 60 || seeked[1] != (gol.TurnComplete{CompletedTurns: 60}) {
+		t.Fatalf("Expected the replay to start with the board at turn 60, got %#v and %#v", seeked[0], seeked[1])
+	}
+	assertEqualBoard(t, boardAt(seeked, 60), boardAt(run, 60), size)
+	assertEqualBoard(t, boardAt(seeked, 99), boardAt(run, 99), size)
+
+	// A log cut short by a crash has no index, but replays up to its last whole record.
+	truncated, err := gol.OpenEventLog(bytes.NewReader(b.Bytes()[:b.Len()/2]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if partial := replayAll(t, truncated, 0); len(partial) == 0 || !reflect.DeepEqual(partial, run[:len(partial)]) {
+		t.Fatalf("Expected a prefix of the events of the run, got %v events", len(partial))
+	}
+
+	// A corrupt header length or index offset is an error rather than a huge allocation or a seek outside the log.
+	corrupt := append([]byte(nil), b.Bytes()...)
+	binary.BigEndian.PutUint64(corrupt[len(corrupt)-8-len("GOLINDEX"):], 1<<62)
+	if _, err := gol.OpenEventLog(bytes.NewReader(corrupt)); err == nil {
+		t.Fatal("Expected an error for an index beyond the end of the log")
+	}
+	header := append([]byte(nil), b.Bytes()[:len("GOLEVENTS\x01")]...)
+	header = append(header, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x7f)
+	if _, err := gol.OpenEventLog(bytes.NewReader(header)); err == nil {
+		t.Fatal("Expected an error for a header longer than the log")
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// TestGenerations tests Brian's Brain and Star Wars on 16x16 and 64x64 images on 1 and 100 turns using 1, 4 and 8 worker threads.
+// Both the alive and the dying cells are checked.
+func TestGenerations(t *testing.T) {
+	rules := []string{"B2/S/C3", "B2/S345/C4"}
+	tests := []gol.Params{
+		{ImageWidth: 16, ImageHeight: 16},
+		{ImageWidth: 64, ImageHeight: 64},
+	}
+	for _, ruleString := range rules {
+		rule, err := gol.ParseRule(ruleString)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, p := range tests {
+			p.Rule = rule
+			for _, turns := range []int{1, 100} {
+				p.Turns = turns
+				path := "check/images/rules/" + strings.Replace(ruleString, "/", "", -1) + fmt.Sprintf("/%vx%vx%v.pgm", p.ImageWidth, p.ImageHeight, turns)
+				expectedAlive := util.ReadAliveCells(path, p.ImageWidth, p.ImageHeight)
+				expectedDying := util.ReadDyingCells(path, p.ImageWidth, p.ImageHeight)
+				for _, threads := range []int{1, 4, 8} {
+					p.Threads = threads
+					testName := fmt.Sprintf("%v-%dx%dx%d-%d", rule, p.ImageWidth, p.ImageHeight, p.Turns, p.Threads)
+					t.Run(testName, func(t *testing.T) {
+						events := make(chan gol.Event)
+						gol.Run(p, events, nil)
+						var alive, dying []util.Cell
+						for event := range events {
+							switch e := event.(type) {
+							case gol.FinalTurnComplete:
+								alive = e.Alive
+								dying = e.Dying
+							}
+						}
+						assertEqualBoard(t, alive, expectedAlive, p)
+						assertEqualBoard(t, dying, expectedDying, p)
+					})
+				}
+			}
+		}
+	}
+}
+
+// TestParseGenerationsRule checks the notations for Generations rules.
+func TestParseGenerationsRule(t *testing.T) {
+	for _, rs := range []string{"B2/S/C3", "b2s/c3", "/2/3", "B2/S/3"} {
+		rule, err := gol.ParseRule(rs)
+		if err != nil {
+			t.Errorf("%q: %v", rs, err)
+			continue
+		}
+		if rule.String() != "B2/S/C3" || rule.States != 3 {
+			t.Errorf("%q parsed as %v, expected B2/S/C3", rs, rule)
+		}
+	}
+	for _, rs := range []string{"B2/S/C1", "B2/S/C257", "B2/S/Cx"} {
+		if _, err := gol.ParseRule(rs); err == nil {
+			t.Errorf("%q: expected an error", rs)
+		}
+	}
+}
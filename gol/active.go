@@ -0,0 +1,153 @@
+package gol
+
+import (
+	"image"
+	"sync"
+)
+
+// activeTileSize is the side of the square tiles in which the Cells engine tracks changes.
+// A tile is only computed if a cell in it or next to it changed in the last turn, otherwise it cannot change.
+const activeTileSize = 16
+
+// activeTiles records which tiles of a bounded world have to be computed in this turn and,
+// as the changes of this turn are marked, which tiles have to be computed in the next one.
+type activeTiles struct {
+	width, height int // size of the world in cells
+	t             Topology
+	active        [][]bool // indexed [x][y] in tiles
+	next          [][]bool
+}
+
+// newActiveTiles returns the tiles of a world with every tile active, as nothing is known about the first turn.
+func newActiveTiles(width, height int, t Topology) *activeTiles {
+	active := make([][]bool, (width+activeTileSize-1)/activeTileSize)
+	next := make([][]bool, len(active))
+	for i := range active {
+		active[i] = make([]bool, (height+activeTileSize-1)/activeTileSize)
+		next[i] = make([]bool, len(active[i]))
+		for j := range active[i] {
+			active[i][j] = true
+		}
+	}
+	return &activeTiles{width, height, t, active, next}
+}
+
+// rect returns the cells of a tile. Tiles on the far edges are smaller if the tile size does not divide the world.
+func (a *activeTiles) rect(key tileKey) image.Rectangle {
+	r := image.Rect(key.x*activeTileSize, key.y*activeTileSize, (key.x+1)*activeTileSize, (key.y+1)*activeTileSize)
+	return r.Intersect(image.Rect(0, 0, a.width, a.height))
+}
+
+// count returns the number of tiles that are computed and skipped in this turn.
+func (a *activeTiles) count() (computed, skipped int) {
+	for x := range a.active {
+		for _, active := range a.active[x] {
+			if active {
+				computed++
+			} else {
+				skipped++
+			}
+		}
+	}
+	return computed, skipped
+}
+
+// advance makes the tiles marked in this turn the active tiles of the next turn.
+func (a *activeTiles) advance() {
+	a.active, a.next = a.next, a.active
+	for x := range a.next {
+		for y := range a.next[x] {
+			a.next[x][y] = false
+		}
+	}
+}
+
+// mark activates, for the next turn, every tile holding a cell in, or next to, the rectangle of changed cells of a tile.
+// The cells next to it are found through the topology, so tiles across twisted edges are activated too.
+func (a *activeTiles) mark(key tileKey, changed image.Rectangle) {
+	if changed.Empty() {
+		return
+	}
+	a.next[key.x][key.y] = true
+	r := changed.Inset(-1)
+	// Only the border of the expanded rectangle can be outside of the tile.
+	for x := r.Min.X; x < r.Max.X; x++ {
+		step := r.Dy() - 1
+		if x == r.Min.X || x == r.Max.X-1 {
+			step = 1
+		}
+		for y := r.Min.Y; y < r.Max.Y; y += step {
+			if wx, wy, ok := a.t.wrap(x, y, a.width, a.height); ok {
+				a.next[wx/activeTileSize][wy/activeTileSize] = true
+			}
+		}
+	}
+}
+
+// tileResult is the outcome of computing a tile: the rectangle of its cells that changed.
+type tileResult struct {
+	key     tileKey
+	changed image.Rectangle
+}
+
+// queuedTile is an active tile waiting in a tileQueue, or the part of it in the rectangle of the worker it was assigned to.
+type queuedTile struct {
+	key tileKey
+	r   image.Rectangle
+}
+
+// tileQueue holds the active tiles assigned to one worker for a turn. The worker takes tiles from the front
+// and, once it is open, workers that have run out of tiles steal them from the back.
+// The buffer is reused every turn, so that assigning tiles does not allocate.
+type tileQueue struct {
+	sync.Mutex
+	tiles []queuedTile
+	head  int
+	ready bool
+}
+
+// assign replaces the tiles of the queue with the active tiles of a rectangle.
+func (q *tileQueue) assign(a *activeTiles, b image.Rectangle) {
+	q.Lock()
+	defer q.Unlock()
+	q.tiles, q.head, q.ready = q.tiles[:0], 0, false
+	if b.Empty() {
+		return
+	}
+	for ty := b.Min.Y / activeTileSize; ty <= (b.Max.Y-1)/activeTileSize; ty++ {
+		for tx := b.Min.X / activeTileSize; tx <= (b.Max.X-1)/activeTileSize; tx++ {
+			if a.active[tx][ty] {
+				key := tileKey{tx, ty}
+				q.tiles = append(q.tiles, queuedTile{key, a.rect(key).Intersect(b)})
+			}
+		}
+	}
+}
+
+func (q *tileQueue) pop() (queuedTile, bool) {
+	q.Lock()
+	defer q.Unlock()
+	if q.head == len(q.tiles) {
+		return queuedTile{}, false
+	}
+	q.head++
+	return q.tiles[q.head-1], true
+}
+
+// open lets other workers steal from the queue, once the halo its tiles are computed from has arrived.
+func (q *tileQueue) open() {
+	q.Lock()
+	defer q.Unlock()
+	q.ready = true
+}
+
+func (q *tileQueue) steal() (queuedTile, bool) {
+	q.Lock()
+	defer q.Unlock()
+	if !q.ready || q.head == len(q.tiles) {
+		return queuedTile{}, false
+	}
+	tile := q.tiles[len(q.tiles)-1]
+	q.tiles = q.tiles[:len(q.tiles)-1]
+	return tile, true
+}
@@ -0,0 +1,280 @@
+package gol
+
+import (
+	"fmt"
+	"image"
+	"math/bits"
+
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// bitBoard is a two-state world packed 64 cells to a word. Bit i of word k of a row is the cell at x = 64k+i.
+// Bits past the width of the board are always zero.
+type bitBoard struct {
+	width, height int
+	stride        int
+	words         []uint64
+}
+
+func newBitBoard(width, height int) *bitBoard {
+	stride := (width + 63) / 64
+	return &bitBoard{width, height, stride, make([]uint64, stride*height)}
+}
+
+func (b *bitBoard) row(y int) []uint64 {
+	return b.words[y*b.stride : (y+1)*b.stride]
+}
+
+func (b *bitBoard) bit(x, y int) uint64 {
+	return (b.words[y*b.stride+x/64] >> uint(x%64)) & 1
+}
+
+// bitPacked is the engine that computes 64 cells at a time with a bit-sliced adder.
+// The next generation is computed into scratch, which is then swapped with board.
+type bitPacked struct {
+	p       Params
+	c       distributorChannels
+	board   *bitBoard
+	scratch *bitBoard
+	workers []*bitWorker
+	// finished receives the index of every worker once it has computed its rows of a turn.
+	finished chan int
+}
+
+// bitWorker is a long-lived goroutine that computes a band of rows of the board every turn.
+type bitWorker struct {
+	index      int
+	start, end int
+	// north and south hold the rows beyond the top and bottom of the board, built through the topology
+	// by the workers whose bands touch those edges.
+	north, south []uint64
+	turns        chan int
+	// flipped holds the cells changed by the last turn, which are sent once every worker has finished it.
+	flipped flips
+}
+
+// bitPackedSupports returns an error if the BitPacked engine cannot simulate a world with the given parameters.
+func bitPackedSupports(p Params) error {
+	if p.Rule.stateCount() != 2 {
+		return fmt.Errorf("BitPacked does not support Generations rules")
+	}
+	if p.Topology == Unbounded {
+		return fmt.Errorf("BitPacked does not support an unbounded plane")
+	}
+	return nil
+}
+
+// newBitPacked packs a world indexed [y][x]. This is the only conversion from the byte per cell format
+// until the world is written out. It starts p.Threads workers, each with an even band of rows,
+// which run until stop is called.
+func newBitPacked(p Params, c distributorChannels, world [][]uint8) *bitPacked {
+	board := newBitBoard(p.ImageWidth, p.ImageHeight)
+	for y := range world {
+		for x, value := range world[y] {
+			if value == alive {
+				board.words[y*board.stride+x/64] |= 1 << uint(x%64)
+			}
+		}
+	}
+	e := &bitPacked{
+		p:        p,
+		c:        c,
+		board:    board,
+		scratch:  newBitBoard(p.ImageWidth, p.ImageHeight),
+		workers:  make([]*bitWorker, p.Threads),
+		finished: make(chan int),
+	}
+	for t := range e.workers {
+		w := &bitWorker{
+			index: t,
+			start: t * board.height / p.Threads,
+			end:   (t + 1) * board.height / p.Threads,
+			north: make([]uint64, board.stride),
+			south: make([]uint64, board.stride),
+			turns: make(chan int),
+		}
+		e.workers[t] = w
+		go e.run(w)
+	}
+	return e
+}
+
+func (e *bitPacked) run(w *bitWorker) {
+	for range w.turns {
+		e.calculateNextRows(w)
+		e.finished <- w.index
+	}
+}
+
+// stop stops the workers.
+func (e *bitPacked) stop() {
+	for _, w := range e.workers {
+		close(w.turns)
+	}
+}
+
+// getBit returns the cell at (x, y), which may lie up to one cell beyond the edges of the board.
+func (e *bitPacked) getBit(x, y int) uint64 {
+	x, y, ok := e.p.Topology.wrap(x, y, e.board.width, e.board.height)
+	if !ok {
+		return 0
+	}
+	return e.board.bit(x, y)
+}
+
+// haloRow returns row y of the board, which may be the row above or below the board, in which case it is built into row.
+func (e *bitPacked) haloRow(y int, row []uint64) []uint64 {
+	if y >= 0 && y < e.board.height {
+		return e.board.row(y)
+	}
+	for k := range row {
+		row[k] = 0
+	}
+	for x := 0; x < e.board.width; x++ {
+		row[x/64] |= e.getBit(x, y) << uint(x%64)
+	}
+	return row
+}
+
+// shifted returns the words of a row moved so that each bit holds its west and east neighbour.
+func (e *bitPacked) shifted(row []uint64, k, y int) (uint64, uint64) {
+	valid := e.board.width - 64*k
+	if valid > 64 {
+		valid = 64
+	}
+	var westIn, eastIn uint64
+	if k > 0 {
+		westIn = row[k-1] >> 63
+	} else {
+		westIn = e.getBit(-1, y)
+	}
+	if valid == 64 && k < e.board.stride-1 {
+		eastIn = row[k+1] & 1
+	} else {
+		eastIn = e.getBit(64*k+valid, y)
+	}
+	west := row[k]<<1 | westIn
+	east := row[k]>>1 | eastIn<<uint(valid-1)
+	return west, east
+}
+
+// fullAdd adds three bit planes, returning the sum and carry planes.
+func fullAdd(a, b, c uint64) (uint64, uint64) {
+	return a ^ b ^ c, (a & b) | (c & (a ^ b))
+}
+
+// calculateNextRows computes the band of rows of a worker in the next generation and collects their flipped cells.
+func (e *bitPacked) calculateNextRows(w *bitWorker) {
+	if w.start == w.end {
+		return
+	}
+	rule := e.p.Rule
+	lastMask := ^uint64(0) >> uint(64*e.board.stride-e.board.width)
+	up := e.haloRow(w.start-1, w.north)
+	mid := e.haloRow(w.start, nil)
+	for y := w.start; y < w.end; y++ {
+		down := e.haloRow(y+1, w.south)
+		out := e.scratch.row(y)
+		for k := range out {
+			upW, upE := e.shifted(up, k, y-1)
+			midW, midE := e.shifted(mid, k, y)
+			downW, downE := e.shifted(down, k, y+1)
+
+			// Bit-sliced addition of the eight neighbours into a four bit count b3 b2 b1 b0.
+			sa, ca := fullAdd(upW, up[k], upE)
+			sb, cb := fullAdd(downW, down[k], downE)
+			sc, cc := midW^midE, midW&midE
+			b0, cd := fullAdd(sa, sb, sc)
+			t0, t1 := fullAdd(ca, cb, cc)
+			b1, ce := t0^cd, t0&cd
+			b2, b3 := t1^ce, t1&ce
+
+			var born, survive uint64
+			for n := 0; n <= 8; n++ {
+				if !rule.Birth[n] && !rule.Survival[n] {
+					continue
+				}
+				count := ^uint64(0)
+				for i, plane := range [4]uint64{b0, b1, b2, b3} {
+					if n&(1<<uint(i)) != 0 {
+						count &= plane
+					} else {
+						count &= ^plane
+					}
+				}
+				if rule.Birth[n] {
+					born |= count
+				}
+				if rule.Survival[n] {
+					survive |= count
+				}
+			}
+			cur := mid[k]
+			next := (cur & survive) | (^cur & born)
+			if k == len(out)-1 {
+				next &= lastMask
+			}
+			out[k] = next
+
+			for changed := cur ^ next; changed != 0; changed &= changed - 1 {
+				x := 64*k + bits.TrailingZeros64(changed)
+				value := uint8(dead)
+				if next&(1<<uint(x%64)) != 0 {
+					value = alive
+				}
+				w.flipped.add(x, y, value)
+			}
+		}
+		up, mid = mid, down
+	}
+}
+
+func (e *bitPacked) next(turn, n int) {
+	for i := 0; i < n; i++ {
+		for _, w := range e.workers {
+			w.turns <- turn + i
+		}
+		// The turn barrier: no worker starts the next turn before every worker has finished this one.
+		for range e.workers {
+			<-e.finished
+		}
+		e.board, e.scratch = e.scratch, e.board
+
+		var diff flips
+		for _, w := range e.workers {
+			diff.merge(&w.flipped)
+		}
+		diff.send(e.p, e.c, turn+i)
+	}
+}
+
+func (e *bitPacked) population() int {
+	n := 0
+	for _, word := range e.board.words {
+		n += bits.OnesCount64(word)
+	}
+	return n
+}
+
+func (e *bitPacked) cells(match func(uint8) bool) []util.Cell {
+	var cells []util.Cell
+	for y := 0; y < e.board.height; y++ {
+		for x := 0; x < e.board.width; x++ {
+			if match(e.get(x, y)) {
+				cells = append(cells, util.Cell{X: x, Y: y})
+			}
+		}
+	}
+	return cells
+}
+
+func (e *bitPacked) bounds() image.Rectangle {
+	return image.Rect(0, 0, e.board.width, e.board.height)
+}
+
+func (e *bitPacked) get(x, y int) uint8 {
+	if e.board.bit(x, y) == 1 {
+		return alive
+	}
+	return dead
+}
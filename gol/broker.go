@@ -0,0 +1,154 @@
+package gol
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/rpc"
+	"sync"
+	"time"
+)
+
+// StartRequest hands the initial world of a controller to a broker, replacing any world it held before.
+type StartRequest struct {
+	Params Params
+	World  [][]uint8
+}
+
+// StartResponse is empty.
+type StartResponse struct{}
+
+// StepRequest asks a broker to compute a turn.
+type StepRequest struct {
+	Turn int
+}
+
+// StepResponse holds the cells that flipped in a turn and the number of alive cells after it.
+type StepResponse struct {
+	Flipped []CellFlipped
+	Alive   int
+}
+
+// Broker is the net/rpc service of a broker process. It holds the world of one controller at a time
+// and computes its turns by splitting it into strips between the worker processes.
+type Broker struct {
+	mu         sync.Mutex
+	addresses  []string
+	dispatcher *stripDispatcher
+	p          Params
+	world      [][]uint8
+}
+
+// Start stores the world of a controller and connects to the workers if the broker is not connected yet.
+func (b *Broker) Start(req StartRequest, res *StartResponse) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.dispatcher == nil {
+		dispatcher, err := dialWorkers(b.addresses, func(event Event) {
+			fmt.Println("Completed Turns", event.GetCompletedTurns(), event)
+		})
+		if err != nil {
+			return err
+		}
+		b.dispatcher = dispatcher
+	}
+	b.p = req.Params
+	b.world = req.World
+	return nil
+}
+
+// Step computes the next turn of the world.
+func (b *Broker) Step(req StepRequest, res *StepResponse) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.world == nil {
+		return errors.New("the broker has no world, call Broker.Start first")
+	}
+	world, flipped, err := b.dispatcher.step(b.p, b.world, req.Turn)
+	if err != nil {
+		return err
+	}
+	b.world = world
+	res.Flipped = flipped
+	res.Alive = len(getCurrentAliveCells(world))
+	return nil
+}
+
+// ServeBroker serves a broker that sends strips to the workers at the given addresses on a listener until it is closed.
+func ServeBroker(l net.Listener, workers []string) error {
+	if len(workers) == 0 {
+		return errors.New("a broker needs at least one worker")
+	}
+	server := rpc.NewServer()
+	if err := server.Register(&Broker{addresses: workers}); err != nil {
+		return err
+	}
+	server.Accept(l)
+	return nil
+}
+
+// calculateWorldRemote executes all turns on the broker at p.Broker. The world is kept up to date locally
+// from the flipped cells, so key presses, snapshots and the final events are handled as for a local world.
+// If the broker cannot be reached or fails a turn, the run ends with a RunFailed event, writing out the world reached.
+func calculateWorldRemote(p Params, c distributorChannels, world [][]uint8, start int) {
+	client, err := rpc.Dial("tcp", p.Broker)
+	if err != nil {
+		failRun(c, start, err, nil)
+		return
+	}
+	defer client.Close()
+	if err := client.Call("Broker.Start", StartRequest{p, world}, new(StartResponse)); err != nil {
+		failRun(c, start, err, nil)
+		return
+	}
+
+	ticker := createTicker(2 * time.Second)
+	done := make(chan bool)
+	var turn int
+	numberAlive := len(getCurrentAliveCells(world))
+
+	tickerRun(c, &turn, &numberAlive, done, ticker)
+
+	checkpoints := newCheckpointer(p, start)
+	save := func() {
+		writePgm(p, c, turn, world)
+		writeWorldCheckpoint(p, c, turn, world)
+	}
+	for turn = start; turn < p.Turns; turn++ {
+
+		if manageSdlInput(p, c, &turn, save, done, ticker, &numberAlive) {
+			return
+		}
+		if checkpoints.due(turn) {
+			writeWorldCheckpoint(p, c, turn, world)
+		}
+
+		var res StepResponse
+		if err := client.Call("Broker.Step", StepRequest{turn}, &res); err != nil {
+			ticker.stopTicker(done)
+			failRun(c, turn, err, save)
+			return
+		}
+		var diff flips
+		for _, flipped := range res.Flipped {
+			world[flipped.Cell.Y][flipped.Cell.X] = flipped.Value
+			diff.add(flipped.Cell.X, flipped.Cell.Y, flipped.Value)
+		}
+		diff.send(p, c, turn)
+
+		c.events <- TurnComplete{
+			CompletedTurns: turn,
+		}
+		numberAlive = res.Alive
+	}
+
+	writePgm(p, c, p.Turns, world)
+
+	c.events <- FinalTurnComplete{
+		CompletedTurns: p.Turns,
+		Alive:          getCurrentAliveCells(world),
+		Dying:          getCurrentDyingCells(world),
+	}
+
+	closeProgramm(c, p.Turns, done, ticker)
+}
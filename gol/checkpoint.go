@@ -0,0 +1,171 @@
+package gol
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"time"
+
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// A checkpoint is a pgm file of the world whose header comments record the completed turns and the settings
+// of the run, so that it can be resumed from that turn:
+//
+//	P5
+//	# turn 40
+//	# turns 100
+//	# board 512 512
+//	# rule B3/S23
+//	# topology torus
+//	# engine cells
+//	# decomposition auto
+//	512 512
+//	255
+//
+// On an unbounded plane the raster only covers the cells that are not dead and an "# origin x y" comment records its position.
+type checkpoint struct {
+	turn          int
+	turns         int
+	width, height int
+	rule          Rule
+	topology      Topology
+	engine        Engine
+	decomposition Decomposition
+	region        image.Rectangle
+}
+
+// checkpointHeader returns the header of a checkpoint of the cells of region after turn completed turns.
+func checkpointHeader(p Params, turn int, region image.Rectangle) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "P5\n# turn %d\n# turns %d\n# board %d %d\n", turn, p.Turns, p.ImageWidth, p.ImageHeight)
+	fmt.Fprintf(&b, "# rule %v\n# topology %v\n# engine %v\n# decomposition %v\n", p.Rule, p.Topology, p.Engine, p.Decomposition)
+	if p.Topology == Unbounded {
+		fmt.Fprintf(&b, "# origin %d %d\n", region.Min.X, region.Min.Y)
+	}
+	fmt.Fprintf(&b, "%d %d\n255\n", region.Dx(), region.Dy())
+	return b.String()
+}
+
+// readCheckpoint reads a checkpoint and returns it with its raster.
+func readCheckpoint(path string) (checkpoint, []byte, error) {
+	var cp checkpoint
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return cp, nil, err
+	}
+	header, pixels, err := util.ParsePgm(data)
+	if err != nil {
+		return cp, nil, err
+	}
+	cp.region = image.Rect(0, 0, header.Width, header.Height).Add(header.Origin)
+
+	values := make(map[string]string)
+	for _, comment := range header.Comments {
+		fields := strings.SplitN(comment, " ", 2)
+		if len(fields) == 2 {
+			values[fields[0]] = strings.TrimSpace(fields[1])
+		}
+	}
+	for _, key := range []string{"turn", "turns", "board", "rule", "topology", "engine", "decomposition"} {
+		if _, ok := values[key]; !ok {
+			return cp, nil, fmt.Errorf("%v is not a checkpoint: no %q comment", path, key)
+		}
+	}
+	if cp.turn, err = strconv.Atoi(values["turn"]); err != nil {
+		return cp, nil, fmt.Errorf("invalid turn %q", values["turn"])
+	}
+	if cp.turns, err = strconv.Atoi(values["turns"]); err != nil {
+		return cp, nil, fmt.Errorf("invalid turns %q", values["turns"])
+	}
+	if n, _ := fmt.Sscanf(values["board"], "%d %d", &cp.width, &cp.height); n != 2 {
+		return cp, nil, fmt.Errorf("invalid board %q", values["board"])
+	}
+	if cp.rule, err = ParseRule(values["rule"]); err != nil {
+		return cp, nil, err
+	}
+	if cp.topology, err = ParseTopology(values["topology"], cp.width, cp.height); err != nil {
+		return cp, nil, err
+	}
+	if cp.engine, err = ParseEngine(values["engine"]); err != nil {
+		return cp, nil, err
+	}
+	if cp.decomposition, err = ParseDecomposition(values["decomposition"]); err != nil {
+		return cp, nil, err
+	}
+	if cp.topology != Unbounded && (header.Width != cp.width || header.Height != cp.height) {
+		return cp, nil, errors.New("the raster of the checkpoint does not cover the board")
+	}
+	return cp, pixels, nil
+}
+
+// resumeParams returns the parameters of a run resumed from the checkpoint at p.Resume, if there is one.
+// The board, rule, topology, engine and decomposition of the checkpoint replace those of p, and so do its turns
+// if p.Turns is 0, so that a run can be resumed for more turns than it was started with.
+// The threads, the remote processes and the checkpoint settings are kept.
+func resumeParams(p Params) (Params, error) {
+	if p.Resume == "" || p.resumed != nil {
+		return p, nil
+	}
+	cp, pixels, err := readCheckpoint(p.Resume)
+	if err != nil {
+		return p, err
+	}
+	p.resumed, p.resumedCells = &cp, pixels
+	p.ImageWidth, p.ImageHeight = cp.width, cp.height
+	if p.Turns == 0 {
+		p.Turns = cp.turns
+	}
+	p.Rule = cp.rule
+	p.Topology = cp.topology
+	p.Engine = cp.engine
+	p.Decomposition = cp.decomposition
+	return p, nil
+}
+
+// checkpointer decides when the distributor writes a checkpoint,
+// every p.CheckpointTurns turns and every p.CheckpointPeriod, whichever comes first.
+type checkpointer struct {
+	p        Params
+	lastTurn int
+	lastTime time.Time
+}
+
+func newCheckpointer(p Params, start int) *checkpointer {
+	return &checkpointer{p, start, time.Now()}
+}
+
+// due returns whether a checkpoint should be written after turn completed turns, and if so starts counting again.
+func (k *checkpointer) due(turn int) bool {
+	if turn == k.lastTurn {
+		return false
+	}
+	if (k.p.CheckpointTurns > 0 && turn-k.lastTurn >= k.p.CheckpointTurns) ||
+		(k.p.CheckpointPeriod > 0 && time.Since(k.lastTime) >= k.p.CheckpointPeriod) {
+		k.lastTurn = turn
+		k.lastTime = time.Now()
+		return true
+	}
+	return false
+}
+
+// writeCheckpoint writes a checkpoint of the cells of region after turn completed turns.
+func writeCheckpoint(p Params, c distributorChannels, turn int, region image.Rectangle, get func(x, y int) uint8) {
+	c.ioCommand <- ioOutputCheckpoint
+	c.ioFilename <- fmt.Sprintf("%vx%vx%v.checkpoint", p.ImageWidth, p.ImageHeight, p.Turns)
+	c.ioTurn <- turn
+	c.ioRegion <- region
+	for y := region.Min.Y; y < region.Max.Y; y++ {
+		for x := region.Min.X; x < region.Max.X; x++ {
+			c.ioOutput <- get(x, y)
+		}
+	}
+}
+
+// writeWorldCheckpoint writes a checkpoint of a bounded world.
+func writeWorldCheckpoint(p Params, c distributorChannels, turn int, world [][]uint8) {
+	writeCheckpoint(p, c, turn, image.Rect(0, 0, p.ImageWidth, p.ImageHeight), func(x, y int) uint8 { return world[y][x] })
+}
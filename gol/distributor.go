@@ -2,6 +2,7 @@ package gol
 
 import (
 	"fmt"
+	"image"
 	"time"
 
 	"uk.ac.bris.cs/gameoflife/util"
@@ -17,52 +18,114 @@ type distributorChannels struct {
 	ioFilename    chan<- string
 	ioOutput      chan<- uint8
 	ioInput       <-chan uint8
+	ioRegion      chan image.Rectangle
 	sdlKeyPresses <-chan rune
-	stopResume    [16]chan bool
+	stopResume    []chan bool
+	ioTurn        chan int
 }
 
 func mod(x, m int) int {
 	return (x + m) % m
 }
 
-// Return the initial world as a 2D slice.
-func getInitialWorld(p Params, c distributorChannels) [][]uint8 {
+// Return the initial world as a 2D slice, indexed [y][x] like the image, and the number of turns it has completed:
+// 0 for the image or a pattern, or the turns recorded in the checkpoint when resuming.
+func getInitialWorld(p Params, c distributorChannels) ([][]uint8, int) {
+	turn := 0
+	region := image.Rect(0, 0, p.ImageWidth, p.ImageHeight)
+	switch {
+	case p.Resume != "":
+		c.ioCommand <- ioInputCheckpoint
+		c.ioFilename <- p.Resume
+		turn = <-c.ioTurn
+		<-c.ioRegion
+	case p.Input != "":
+		c.ioCommand <- ioInputPattern
+		c.ioFilename <- p.Input
+		region = <-c.ioRegion
+	default:
+		c.ioCommand <- ioInput
+		c.ioFilename <- fmt.Sprintf("%vx%v", p.ImageWidth, p.ImageHeight)
+	}
 
 	initialWorld := make([][]byte, p.ImageHeight)
 	for i := range initialWorld {
 		initialWorld[i] = make([]byte, p.ImageWidth)
 	}
 
-	for x := 0; x < p.ImageHeight; x++ {
-		for y := 0; y < p.ImageWidth; y++ {
-			initialWorld[y][x] = <-c.ioInput // (Y,X) !!!!!!
+	for y := region.Min.Y; y < region.Max.Y; y++ {
+		for x := region.Min.X; x < region.Max.X; x++ {
+			initialWorld[y][x] = p.Rule.normalise(<-c.ioInput)
 		}
 	}
 
-	aliveCells := getCurrentAliveCells(initialWorld) // Could do this in the for-loop above! (tiny improvement)
-
-	for _, x := range aliveCells {
-		initialWorld[x.X][x.Y] = 255
-		cellChanged := CellFlipped{
-			CompletedTurns: 0,
-			Cell:           x,
+	var initial flips
+	for y, row := range initialWorld {
+		for x, value := range row {
+			if value != dead {
+				initial.add(x, y, value)
+			}
 		}
-		c.events <- cellChanged
 	}
+	initial.send(p, c, turn)
 
-	return initialWorld
+	return initialWorld, turn
+}
+
+// flips collects the cells that change state in a turn, to be sent together once the turn has been computed.
+type flips struct {
+	cells  []util.Cell
+	values []uint8
+}
+
+func (f *flips) add(x, y int, value uint8) {
+	f.cells = append(f.cells, util.Cell{X: x, Y: y})
+	f.values = append(f.values, value)
+}
+
+// merge appends the cells collected by another goroutine, which may then reuse its buffers.
+func (f *flips) merge(other *flips) {
+	f.cells = append(f.cells, other.cells...)
+	f.values = append(f.values, other.values...)
+	other.cells, other.values = other.cells[:0], other.values[:0]
+}
+
+// send sends the cells as a TurnDiff event, or as a CellFlipped event per cell with p.CellEvents, and empties f.
+// The TurnDiff keeps the buffers, so f starts new ones for the next turn, as large as this turn's,
+// which allocates each of them once rather than growing them cell by cell.
+func (f *flips) send(p Params, c distributorChannels, turn int) {
+	if len(f.cells) == 0 {
+		return
+	}
+	if p.CellEvents {
+		for i, cell := range f.cells {
+			c.events <- CellFlipped{
+				CompletedTurns: turn,
+				Cell:           cell,
+				Value:          f.values[i],
+			}
+		}
+		f.cells, f.values = f.cells[:0], f.values[:0]
+		return
+	}
+	c.events <- TurnDiff{
+		CompletedTurns: turn,
+		Cells:          f.cells,
+		Values:         f.values,
+	}
+	f.cells, f.values = make([]util.Cell, 0, len(f.cells)), make([]uint8, 0, len(f.values))
 }
 
 // Return all alive cells.
 func getCurrentAliveCells(world [][]uint8) []util.Cell {
 	var cells []util.Cell
 
-	for i, x := range world {
-		for j, y := range x {
-			if y != 0 {
+	for y, row := range world {
+		for x, value := range row {
+			if value == alive {
 				cells = append(cells, util.Cell{
-					X: i,
-					Y: j,
+					X: x,
+					Y: y,
 				})
 			}
 		}
@@ -71,206 +134,132 @@ func getCurrentAliveCells(world [][]uint8) []util.Cell {
 	return cells
 }
 
-func calculateNeighbours(x, y int, world [][]uint8) int {
-	height := len(world)
-	width := len(world[0])
+// Return all cells in a refractory (dying) state of a Generations rule.
+func getCurrentDyingCells(world [][]uint8) []util.Cell {
+	var cells []util.Cell
 
-	neighbours := 0
-	for i := -1; i <= 1; i++ {
-		for j := -1; j <= 1; j++ {
-			if i != 0 || j != 0 {
-				if world[mod(x+i, height)][mod(y+j, width)] == alive {
-					neighbours++
-				}
+	for y, row := range world {
+		for x, value := range row {
+			if value != alive && value != dead {
+				cells = append(cells, util.Cell{
+					X: x,
+					Y: y,
+				})
 			}
 		}
 	}
-	return neighbours
-}
-
-func calculateNextWorld(c distributorChannels, chunk chan [][]uint8, turn int, offset int, routineNumber int) {
-	world := <-chunk
 
-	height := len(world)
-	width := len(world[0])
+	return cells
+}
 
-	newWorld := make([][]byte, height)
-	for i := range newWorld {
-		newWorld[i] = make([]byte, width)
+// cellAt returns the value of the cell at (x, y), which may lie up to one cell beyond the edges of the world.
+func cellAt(world [][]uint8, x, y int, t Topology) uint8 {
+	x, y, ok := t.wrap(x, y, len(world[0]), len(world))
+	if !ok {
+		return dead
 	}
+	return world[y][x]
+}
 
-	for x := 1; x < height-1; x++ {
-		for y := 0; y < width; y++ {
-
-			select {
-			case value1 := <-c.stopResume[routineNumber]:
-				fmt.Println("Goroutine [", routineNumber, "] has stopped. Its value is: ", value1)
-				value2 := <-c.stopResume[routineNumber]
-				fmt.Println("Goroutine [", routineNumber, "] has resumed. Its value is: ", value2)
-			default:
-			}
-
-			neighbours := calculateNeighbours(x, y, world)
-			if world[x][y] == alive {
-				if neighbours == 2 || neighbours == 3 {
-					newWorld[x][y] = alive
-				} else {
-					c.events <- CellFlipped{
-						CompletedTurns: turn,
-						Cell:           util.Cell{X: x + offset - 1, Y: y},
-					}
-					newWorld[x][y] = dead
-				}
-			} else {
-				if neighbours == 3 {
-					c.events <- CellFlipped{
-						CompletedTurns: turn,
-						Cell:           util.Cell{X: x + offset - 1, Y: y},
-					}
-					newWorld[x][y] = alive
-				} else {
-					newWorld[x][y] = dead
+// calculateNeighbours counts the alive neighbours of a cell that is not on the border of padded rows.
+func calculateNeighbours(y, x int, world [][]uint8) int {
+	neighbours := 0
+	for i := -1; i <= 1; i++ {
+		for j := -1; j <= 1; j++ {
+			if i != 0 || j != 0 {
+				if world[y+i][x+j] == alive {
+					neighbours++
 				}
 			}
 		}
 	}
-	newWorld = newWorld[1:(height - 1)]
-	chunk <- newWorld
+	return neighbours
 }
 
-func calculateWorld(p Params, c distributorChannels, world [][]uint8) {
-
-	ticker := createTicker(2 * time.Second)
-	done := make(chan bool)
-	var turn int
-	var numberAlive int
+// calculateWorldParallel executes all turns with a pool of workers that each own a strip of the world.
+// Only the tiles with a change in their neighbourhood in the last turn are computed.
+func calculateWorldParallel(p Params, c distributorChannels, world [][]uint8, start int) {
 
-	tickerRun(c, &turn, &numberAlive, done, ticker)
-
-	newWorld := append([][]byte{world[p.ImageWidth-1]}, world...)
-	newWorld = append(newWorld, [][]byte{world[0]}...)
-	for turn = 0; turn < p.Turns; turn++ {
-
-		if manageSdlInput(p, c, &turn, &world, done, ticker, &numberAlive) {
-			return
-		}
-
-		chunk := make(chan [][]byte)
-		go calculateNextWorld(c, chunk, turn, 0, 0)
-		chunk <- newWorld
-
-		newWorld = <-chunk
-		world = newWorld
-		newWorld = append([][]byte{newWorld[p.ImageWidth-1]}, newWorld...)
-		newWorld = append(newWorld, [][]byte{newWorld[1]}...)
-
-		c.events <- TurnComplete{
-			CompletedTurns: turn,
+	tiles := newActiveTiles(p.ImageWidth, p.ImageHeight, p.Topology)
+	finished := make(chan int)
+	workers := newWorkerPool(p, c, tiles, world, finished)
+	defer func() {
+		for _, w := range workers {
+			close(w.turns)
 		}
-		numberAlive = len(getCurrentAliveCells(world))
-	}
-
-	//world = world[1 : p.ImageWidth-1]
-
-	writePgm(p, c, p.Turns, world)
-
-	c.events <- FinalTurnComplete{
-		CompletedTurns: p.Turns,
-		Alive:          getCurrentAliveCells(world),
-	}
-
-	closeProgramm(c, p.Turns, done, ticker)
-}
-
-func calculateWorldParallel(p Params, c distributorChannels, world [][]uint8) {
-
-	chunk := make([]chan [][]byte, p.Threads)
-	worldsChunk := make([][][]uint8, p.Threads)
-
-	chunkWidth := p.ImageWidth / p.Threads
-
-	//Making the world for the first thread
-	worldsChunk[0] = append([][]byte{world[p.ImageWidth-1]}, world[0:chunkWidth+1]...)
-	// Making the world for the last thread (if there is more than one thread)
-	worldsChunk[p.Threads-1] = append(world[((p.Threads-1)*chunkWidth-1):], [][]byte{world[0]}...)
-
-	for i := 1; i < p.Threads-1; i++ {
-		worldsChunk[i] = world[(chunkWidth*i - 1):(chunkWidth*(i+1) + 1)]
-	}
-	// Now we have all the worldsChunk
-
-	//make another for statement for p.Threads = 1
+	}()
 
 	ticker := createTicker(2 * time.Second)
 	done := make(chan bool)
 	var turn int
-	var numberAlive int
+	numberAlive := len(getCurrentAliveCells(world))
 
 	tickerRun(c, &turn, &numberAlive, done, ticker)
 
-	for turn = 0; turn < p.Turns; turn++ {
+	checkpoints := newCheckpointer(p, start)
+	// The world is only gathered from the workers when it is saved.
+	save := func() {
+		gatherWorld(workers, world)
+		writePgm(p, c, turn, world)
+		writeWorldCheckpoint(p, c, turn, world)
+	}
+	// The cells flipped by the workers are sent together once the turn is complete.
+	var diff flips
+	for turn = start; turn < p.Turns; turn++ {
 
-		if manageSdlInput(p, c, &turn, &world, done, ticker, &numberAlive) {
+		if manageSdlInput(p, c, &turn, save, done, ticker, &numberAlive) {
 			return
 		}
-
-		for i := 0; i < p.Threads; i++ { // Making the worlds for all the threads exept the first and the last
-			// ((chunkWidth * i) - 1) -> (chunkWidth * (i+1))
-			offset := i * chunkWidth
-			chunk[i] = make(chan [][]byte)
-			go calculateNextWorld(c, chunk[i], turn, offset, i)
-			chunk[i] <- worldsChunk[i]
-		}
-
-		// for i := 0; i < p.Threads; i++ {
-		// 	newWorld = append(newWorld, <-chunk[i]...)
-		// }
-		//instead of appending the whole world, append only the lines that need to be appended for each chunk
-		numberAliveThisTurn := 0
-		for i := 0; i < p.Threads; i++ {
-			worldsChunk[i] = <-chunk[i]
-			numberAliveThisTurn += len(getCurrentAliveCells(worldsChunk[i]))
+		if checkpoints.due(turn) {
+			gatherWorld(workers, world)
+			writeWorldCheckpoint(p, c, turn, world)
 		}
 
-		worldsChunk[0] = append([][]byte{worldsChunk[p.Threads-1][len(worldsChunk[p.Threads-1])-1]}, worldsChunk[0]...)
-		worldsChunk[0] = append(worldsChunk[0], [][]byte{worldsChunk[1][0]}...)
+		computed, skipped := tiles.count()
+		numberAliveThisTurn := numberAlive + runTurn(workers, tiles, finished, turn, &diff)
 
-		for i := 1; i < p.Threads-1; i++ {
-			worldsChunk[i] = append([][]byte{worldsChunk[i-1][len(worldsChunk[i-1])-2]}, worldsChunk[i]...)
-			worldsChunk[i] = append(worldsChunk[i], [][]byte{worldsChunk[i+1][0]}...)
+		diff.send(p, c, turn)
+		c.events <- TileStats{
+			CompletedTurns: turn,
+			Computed:       computed,
+			Skipped:        skipped,
 		}
-
-		worldsChunk[p.Threads-1] = append([][]byte{worldsChunk[p.Threads-2][len(worldsChunk[p.Threads-2])-2]}, worldsChunk[p.Threads-1]...)
-		worldsChunk[p.Threads-1] = append(worldsChunk[p.Threads-1], [][]byte{worldsChunk[0][1]}...)
-
 		c.events <- TurnComplete{
 			CompletedTurns: turn,
 		}
 		numberAlive = numberAliveThisTurn
 	}
 
-	var resultWorld [][]uint8
-
-	for i := 0; i < p.Threads; i++ {
-		resultWorld = append(resultWorld, worldsChunk[i][1:(len(worldsChunk[i])-1)]...)
-	}
-
-	writePgm(p, c, p.Turns, resultWorld)
+	gatherWorld(workers, world)
+	writePgm(p, c, p.Turns, world)
 
 	c.events <- FinalTurnComplete{
 		CompletedTurns: p.Turns,
-		Alive:          getCurrentAliveCells(resultWorld),
+		Alive:          getCurrentAliveCells(world),
+		Dying:          getCurrentDyingCells(world),
 	}
 
 	closeProgramm(c, p.Turns, done, ticker)
 }
 
+// outputName returns the name of the image of the world after turn completed turns, without its extension.
+// The final image is named after p.Turns and every snapshot taken on the way after its own turn, so none overwrites another.
+func outputName(p Params, turn int) string {
+	return fmt.Sprintf("%vx%vx%v", p.ImageWidth, p.ImageHeight, turn)
+}
+
+// writePgm writes the world to a pgm or pbm file, or to a pattern file if p.OutputFormat is a pattern format.
 func writePgm(p Params, c distributorChannels, turn int, world [][]uint8) {
-	fileName := fmt.Sprintf("%vx%vx%v", p.ImageWidth, p.ImageHeight, p.Turns)
+	if !p.OutputFormat.image() {
+		writePattern(p, c, turn, image.Rect(0, 0, p.ImageWidth, p.ImageHeight), func(x, y int) uint8 { return world[y][x] })
+		return
+	}
+	fileName := outputName(p, turn)
 	c.ioCommand <- 0
 	c.ioFilename <- fileName
-	for x := 0; x < p.ImageHeight; x++ {
-		for y := 0; y < p.ImageWidth; y++ {
+	c.ioTurn <- turn
+	for y := 0; y < p.ImageHeight; y++ {
+		for x := 0; x < p.ImageWidth; x++ {
 			c.ioOutput <- world[y][x]
 		}
 	}
@@ -279,7 +268,11 @@ func writePgm(p Params, c distributorChannels, turn int, world [][]uint8) {
 
 func pauseNow(done chan bool, p Params, c distributorChannels, ticker *ticker, turn *int) {
 	for i := 0; i < p.Threads; i++ {
-		c.stopResume[i] <- true
+		// Workers that have not taken the last signal yet, or engines without workers, are not waited for.
+		select {
+		case c.stopResume[i] <- true:
+		default:
+		}
 	}
 	ticker.stopTicker(done)
 	c.events <- StateChange{*turn, Paused}
@@ -287,20 +280,28 @@ func pauseNow(done chan bool, p Params, c distributorChannels, ticker *ticker, t
 
 func resumeNow(done chan bool, p Params, c distributorChannels, ticker *ticker, turn *int, numberAlive *int) {
 	for i := 0; i < p.Threads; i++ {
-		c.stopResume[i] <- false
+		// Workers that have not taken the last signal yet, or engines without workers, are not waited for.
+		select {
+		case c.stopResume[i] <- false:
+		default:
+		}
 	}
 	ticker.resetTicker(c, turn, numberAlive, done)
 	fmt.Println("Continuing")
 	c.events <- StateChange{*turn, Executing}
 }
 
-func manageSdlInput(p Params, c distributorChannels, turn *int, world *[][]uint8, done chan bool, ticker *ticker, numberAlive *int) bool {
+// manageSdlInput handles the key presses received since the last turn. save writes the current world to a pgm file.
+// 'k' writes the world and shuts down. So does 'q', which only reaches the distributor when the viewer runs in the same
+// process, as a server detaches the viewer instead.
+func manageSdlInput(p Params, c distributorChannels, turn *int, save func(), done chan bool, ticker *ticker, numberAlive *int) bool {
 	select {
 	case x := <-c.sdlKeyPresses:
 		if x == 's' {
-			writePgm(p, c, *turn, *world)
-		} else if x == 'q' {
-			writePgm(p, c, *turn, *world)
+			save()
+		} else if x == 'q' || x == 'k' {
+			c.ioCommand <- ioQuitting
+			save()
 			closeProgramm(c, *turn, done, ticker)
 			return true
 		} else if x == 'p' {
@@ -309,9 +310,10 @@ func manageSdlInput(p Params, c distributorChannels, turn *int, world *[][]uint8
 			for resume != 'p' {
 				resume = <-c.sdlKeyPresses
 				if resume == 's' {
-					writePgm(p, c, *turn, *world)
-				} else if resume == 'q' {
-					writePgm(p, c, *turn, *world)
+					save()
+				} else if resume == 'q' || resume == 'k' {
+					c.ioCommand <- ioQuitting
+					save()
 					c.ioCommand <- ioCheckIdle
 					<-c.ioIdle
 					c.events <- StateChange{*turn, Quitting}
@@ -341,13 +343,27 @@ func closeProgramm(c distributorChannels, turn int, done chan bool, ticker *tick
 	close(c.events)
 }
 
+// failRun ends a run that cannot go on after turn completed turns because of err, saving the world reached with save
+// if it is not nil, and quits. The ticker must have been stopped.
+func failRun(c distributorChannels, turn int, err error, save func()) {
+	c.events <- RunFailed{turn, err.Error()}
+	if save != nil {
+		c.ioCommand <- ioQuitting
+		save()
+	}
+	c.ioCommand <- ioCheckIdle
+	<-c.ioIdle
+	c.events <- StateChange{turn, Quitting}
+	close(c.events)
+}
+
 type ticker struct {
 	period time.Duration
-	ticker time.Ticker
+	ticker *time.Ticker
 }
 
 func createTicker(period time.Duration) *ticker {
-	return &ticker{period, *time.NewTicker(period)}
+	return &ticker{period, time.NewTicker(period)}
 }
 
 func (t *ticker) stopTicker(done chan bool) {
@@ -356,7 +372,7 @@ func (t *ticker) stopTicker(done chan bool) {
 }
 
 func (t *ticker) resetTicker(c distributorChannels, turn *int, numberAlive *int, done chan bool) {
-	t.ticker = *time.NewTicker(t.period)
+	t.ticker = time.NewTicker(t.period)
 	tickerRun(c, turn, numberAlive, done, t)
 }
 
@@ -374,25 +390,101 @@ func tickerRun(c distributorChannels, turn *int, numberAlive *int, done chan boo
 	}()
 }
 
+// getInitialSparseWorld reads the initial image, the pattern, or the checkpoint when resuming, into an unbounded world,
+// at the position recorded in the file if there is one. It also returns the number of turns the world has completed.
+func getInitialSparseWorld(p Params, c distributorChannels) (sparseWorld, int) {
+	turn := 0
+	switch {
+	case p.Resume != "":
+		c.ioCommand <- ioInputCheckpoint
+		c.ioFilename <- p.Resume
+		turn = <-c.ioTurn
+	case p.Input != "":
+		c.ioCommand <- ioInputPattern
+		c.ioFilename <- p.Input
+	default:
+		c.ioCommand <- ioInputRegion
+		c.ioFilename <- fmt.Sprintf("%vx%v", p.ImageWidth, p.ImageHeight)
+	}
+	region := <-c.ioRegion
+
+	world := make(sparseWorld)
+	var initial flips
+	for y := region.Min.Y; y < region.Max.Y; y++ {
+		for x := region.Min.X; x < region.Max.X; x++ {
+			value := p.Rule.normalise(<-c.ioInput)
+			if value != dead {
+				world.set(x, y, value)
+				initial.add(x, y, value)
+			}
+		}
+	}
+	initial.send(p, c, turn)
+	return world, turn
+}
+
 // distributor divides the work between workers and interacts with other goroutines.
 func distributor(p Params, c distributorChannels) {
 
-	// READ
-	c.ioCommand <- 1
-	c.ioFilename <- fmt.Sprintf("%vx%v", p.ImageWidth, p.ImageHeight)
+	if p.Topology == Unbounded {
+		world, turn := getInitialSparseWorld(p, c)
+		if p.Engine == HashLife && p.Rule.stateCount() == 2 {
+			runEngine(p, c, newUnboundedHashLife(p, c, world), turn)
+			return
+		}
+		if p.Engine != Cells {
+			fmt.Println("Falling back to the cells engine: the", p.Engine, "engine does not support this rule on an unbounded plane")
+		}
+		runEngine(p, c, &sparseEngine{world, p, c}, turn)
+		return
+	}
 
+	// READ
 	// TODO: Create a 2D slice to store the world.
 	// TODO: For all initially alive cells send a CellFlipped Event.
-	world := getInitialWorld(p, c)
+	world, turn := getInitialWorld(p, c)
 
 	// TODO: Execute all turns of the Game of Life.
 	// TODO: Send correct Events when required, e.g. CellFlipped, TurnComplete and FinalTurnComplete.
 	//		 See event.go for a list of all events.
 
-	if p.Threads == 1 {
-		calculateWorld(p, c, world)
+	if p.Broker != "" {
+		calculateWorldRemote(p, c, world, turn)
+		return
+	}
+
+	if len(p.Workers) > 0 {
+		calculateWorldWorkers(p, c, world, turn)
 		return
 	}
 
-	calculateWorldParallel(p, c, world)
+	if len(p.Peers) > 0 {
+		if err := peerSupports(p); err != nil {
+			fmt.Println("Falling back to computing the turns locally:", err)
+		} else {
+			calculateWorldPeers(p, c, world, turn)
+			return
+		}
+	}
+
+	switch p.Engine {
+	case HashLife:
+		if err := hashLifeSupports(p); err != nil {
+			fmt.Println("Falling back to the cells engine:", err)
+		} else {
+			runEngine(p, c, newTorusHashLife(p, c, world), turn)
+			return
+		}
+	case BitPacked:
+		if err := bitPackedSupports(p); err != nil {
+			fmt.Println("Falling back to the cells engine:", err)
+		} else {
+			e := newBitPacked(p, c, world)
+			defer e.stop()
+			runEngine(p, c, e, turn)
+			return
+		}
+	}
+
+	calculateWorldParallel(p, c, world, turn)
 }
@@ -0,0 +1,154 @@
+package gol
+
+import (
+	"fmt"
+	"image"
+	"strings"
+	"time"
+
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// Engine selects the algorithm used to compute the turns.
+type Engine int
+
+const (
+	// Cells computes every cell of a byte per cell world, split between the worker threads. It supports every rule and topology.
+	Cells Engine = iota
+	// HashLife computes a canonicalised quadtree with memoised results and can advance many turns at once.
+	// It supports two-state rules on a torus whose sides are powers of two and on an unbounded plane.
+	HashLife
+	// BitPacked packs 64 cells into a word and computes them at once with a bit-sliced adder,
+	// split between the worker threads. It supports two-state rules on every bounded topology.
+	BitPacked
+)
+
+var engineNames = map[Engine]string{
+	Cells:     "cells",
+	HashLife:  "hashlife",
+	BitPacked: "bitpacked",
+}
+
+func (e Engine) String() string {
+	if name, ok := engineNames[e]; ok {
+		return name
+	}
+	return "Incorrect Engine"
+}
+
+// ParseEngine returns the engine with the given name.
+func ParseEngine(s string) (Engine, error) {
+	for e, name := range engineNames {
+		if strings.EqualFold(strings.TrimSpace(s), name) {
+			return e, nil
+		}
+	}
+	return Cells, fmt.Errorf("unknown engine %q", s)
+}
+
+// engine computes the turns behind runEngine, which handles the events and key presses.
+type engine interface {
+	// next advances the world by n turns, starting at turn, and sends the changed cells with flips.send:
+	// batched in a TurnDiff event, or as a CellFlipped event per cell with p.CellEvents.
+	next(turn, n int)
+	// population returns the number of alive cells.
+	population() int
+	// cells returns the cells whose value matches.
+	cells(match func(uint8) bool) []util.Cell
+	// bounds returns the board, or the smallest rectangle holding every cell that is not dead on an unbounded plane.
+	bounds() image.Rectangle
+	// get returns the value of a cell.
+	get(x, y int) uint8
+}
+
+// runEngine executes all turns with an engine, completing p.Step turns (at least 1) between each TurnComplete event.
+func runEngine(p Params, c distributorChannels, e engine, start int) {
+	step := p.Step
+	if step < 1 {
+		step = 1
+	}
+
+	ticker := createTicker(2 * time.Second)
+	done := make(chan bool)
+	var turn int
+	var numberAlive int
+
+	tickerRun(c, &turn, &numberAlive, done, ticker)
+
+	checkpoints := newCheckpointer(p, start)
+	save := func() {
+		writeEnginePgm(p, c, turn, e)
+		writeCheckpoint(p, c, turn, e.bounds(), e.get)
+	}
+	for turn = start; turn < p.Turns; {
+
+		if manageSdlInput(p, c, &turn, save, done, ticker, &numberAlive) {
+			return
+		}
+		if checkpoints.due(turn) {
+			writeCheckpoint(p, c, turn, e.bounds(), e.get)
+		}
+
+		n := step
+		if turn+n > p.Turns {
+			n = p.Turns - turn
+		}
+		e.next(turn, n)
+
+		c.events <- TurnComplete{
+			CompletedTurns: turn + n - 1,
+		}
+		numberAlive = e.population()
+		turn += n
+	}
+
+	writeEnginePgm(p, c, p.Turns, e)
+
+	c.events <- FinalTurnComplete{
+		CompletedTurns: p.Turns,
+		Alive:          e.cells(func(value uint8) bool { return value == alive }),
+		Dying:          e.cells(func(value uint8) bool { return value != alive && value != dead }),
+	}
+
+	closeProgramm(c, p.Turns, done, ticker)
+}
+
+// writeEnginePgm writes the world of an engine to a pgm or pbm file, or a pattern file if p.OutputFormat is a pattern format.
+// On an unbounded plane only the region holding cells that are not dead is written, together with its position.
+func writeEnginePgm(p Params, c distributorChannels, turn int, e engine) {
+	fileName := outputName(p, turn)
+	region := e.bounds()
+	if !p.OutputFormat.image() {
+		writePattern(p, c, turn, region, e.get)
+		return
+	}
+	if p.Topology == Unbounded {
+		c.ioCommand <- ioOutputRegion
+		c.ioFilename <- fileName
+		c.ioTurn <- turn
+		c.ioRegion <- region
+	} else {
+		c.ioCommand <- ioOutput
+		c.ioFilename <- fileName
+		c.ioTurn <- turn
+	}
+	for y := region.Min.Y; y < region.Max.Y; y++ {
+		for x := region.Min.X; x < region.Max.X; x++ {
+			c.ioOutput <- e.get(x, y)
+		}
+	}
+	c.events <- ImageOutputComplete{turn, fileName}
+}
+
+// sendFlippedCells sends the cells that differ between two snapshots of a bounded world.
+func sendFlippedCells(p Params, c distributorChannels, turn int, before, after [][]uint8) {
+	var diff flips
+	for y := range after {
+		for x := range after[y] {
+			if before[y][x] != after[y][x] {
+				diff.add(x, y, after[y][x])
+			}
+		}
+	}
+	diff.send(p, c, turn)
+}
@@ -48,14 +48,26 @@ type StateChange struct { // implements Event
 // CellFlipped is an Event notifying the GUI about a change of state of a single cell.
 // This even should be sent every time a cell changes state.
 // Make sure to send this event for all cells that are alive when the image is loaded in.
+// Value is the new grey level of the cell: 255 if alive, 0 if dead and in between for the dying states of Generations rules.
 type CellFlipped struct { // implements Event
 	CompletedTurns int
 	Cell           util.Cell
+	Value          uint8
+}
+
+// TurnDiff is an Event notifying the GUI about every cell that changed state in a turn, sent in place of a CellFlipped
+// event per cell unless Params.CellEvents is set. Values[i] is the new grey level of Cells[i].
+// It is assembled once all of the cells of the turn have been computed, and sent before its TurnComplete event.
+// The cells that are alive when the image is loaded in are sent in a TurnDiff too. No TurnDiff is sent for a turn without changes.
+type TurnDiff struct { // implements Event
+	CompletedTurns int
+	Cells          []util.Cell
+	Values         []uint8
 }
 
 // TurnComplete is an Event notifying the GUI about turn completion.
 // SDL will render a frame when this event is sent.
-// All CellFlipped events must be sent *before* TurnComplete.
+// All CellFlipped and TurnDiff events must be sent *before* TurnComplete.
 type TurnComplete struct { // implements Event
 	CompletedTurns int
 }
@@ -63,9 +75,41 @@ type TurnComplete struct { // implements Event
 // FinalTurnComplete is an Event notifying the testing framework about the new world state after execution finished.
 // The data included with this Event is used directly by the tests.
 // SDL ignores this Event.
+// Dying holds the cells in a refractory state of a Generations rule, these are not included in Alive.
 type FinalTurnComplete struct {
 	CompletedTurns int
 	Alive          []util.Cell
+	Dying          []util.Cell
+}
+
+// TileStats is an Event reporting how much of the world the Cells engine computed in a turn.
+// Computed is the number of tiles with a change in their neighbourhood in the last turn, Skipped the number of the other tiles.
+// It is sent before the TurnComplete event of the turn.
+type TileStats struct { // implements Event
+	CompletedTurns int
+	Computed       int
+	Skipped        int
+}
+
+// WorkerLost is an Event notifying the user that a worker process stopped answering,
+// either by failing a call or by missing heartbeats. Its strips are computed again by the other worker processes.
+type WorkerLost struct { // implements Event
+	CompletedTurns int
+	Worker         string
+}
+
+// WorkerRecovered is an Event notifying the user that the strips of a lost worker process have been computed
+// by the other worker processes, completing the turn in which it was lost.
+type WorkerRecovered struct { // implements Event
+	CompletedTurns int
+	Worker         string
+}
+
+// RunFailed is an Event notifying the user that the run cannot go on, because the broker or the worker processes
+// computing it were lost. The world reached is written out if the distributor still holds it, and the run quits as if 'q' had been pressed.
+type RunFailed struct { // implements Event
+	CompletedTurns int
+	Err            string
 }
 
 // String methods allow the different types of Events and States to be printed.
@@ -115,6 +159,55 @@ func (event CellFlipped) GetCompletedTurns() int {
 	return event.CompletedTurns
 }
 
+func (event TurnDiff) String() string {
+	return fmt.Sprintf("")
+}
+
+func (event TurnDiff) GetCompletedTurns() int {
+	return event.CompletedTurns
+}
+
+// Flipped returns the cells of the diff as CellFlipped events.
+func (event TurnDiff) Flipped() []CellFlipped {
+	flipped := make([]CellFlipped, len(event.Cells))
+	for i, cell := range event.Cells {
+		flipped[i] = CellFlipped{event.CompletedTurns, cell, event.Values[i]}
+	}
+	return flipped
+}
+
+func (event TileStats) String() string {
+	return fmt.Sprintf("")
+}
+
+func (event TileStats) GetCompletedTurns() int {
+	return event.CompletedTurns
+}
+
+func (event WorkerLost) String() string {
+	return fmt.Sprintf("Worker %v lost", event.Worker)
+}
+
+func (event WorkerLost) GetCompletedTurns() int {
+	return event.CompletedTurns
+}
+
+func (event WorkerRecovered) String() string {
+	return fmt.Sprintf("Worker %v recovered", event.Worker)
+}
+
+func (event WorkerRecovered) GetCompletedTurns() int {
+	return event.CompletedTurns
+}
+
+func (event RunFailed) String() string {
+	return fmt.Sprintf("Run failed: %v", event.Err)
+}
+
+func (event RunFailed) GetCompletedTurns() int {
+	return event.CompletedTurns
+}
+
 func (event TurnComplete) String() string {
 	return fmt.Sprintf("")
 }
@@ -0,0 +1,609 @@
+package gol
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// An event log starts with eventLogMagic and the gob encoded Params of the run, followed by one record per event.
+// Every record is a kind byte, the time since the previous record in nanoseconds and the fields of the event,
+// with numbers as varints and strings and lists prefixed with their length. Consecutive CellFlipped events of
+// the same turn share one record, each cell stored as the offset from the previous one, and a TurnDiff is stored
+// the same way in a record of its own. A keyframe record holding
+// every cell that is not dead follows the TurnComplete event of every keyframe turn. The log ends with the index of
+// the keyframes, the position of the index as 8 big endian bytes and eventIndexMagic.
+const (
+	eventLogMagic   = "GOLEVENTS\x01"
+	eventIndexMagic = "GOLINDEX"
+)
+
+// The kinds of the records of an event log.
+const (
+	logAliveCellsCount byte = iota + 1
+	logImageOutputComplete
+	logStateChange
+	logCellsFlipped
+	logTurnComplete
+	logFinalTurnComplete
+	logTileStats
+	logWorkerLost
+	logWorkerRecovered
+	logKeyframe
+	logTurnDiff
+)
+
+// indexEntry is an entry of the index of an event log: the position of the keyframe record of a turn.
+type indexEntry struct {
+	turn   int
+	offset int64
+}
+
+// logWriter writes the records of an event log, keeping track of the position and time of the last record.
+type logWriter struct {
+	w      *bufio.Writer
+	offset int64
+	last   time.Time
+	buf    [binary.MaxVarintLen64]byte
+}
+
+func (l *logWriter) bytes(b []byte) {
+	n, _ := l.w.Write(b)
+	l.offset += int64(n)
+}
+
+func (l *logWriter) varint(n int) {
+	l.bytes(l.buf[:binary.PutVarint(l.buf[:], int64(n))])
+}
+
+func (l *logWriter) uvarint(n uint64) {
+	l.bytes(l.buf[:binary.PutUvarint(l.buf[:], n)])
+}
+
+func (l *logWriter) string(s string) {
+	l.uvarint(uint64(len(s)))
+	l.bytes([]byte(s))
+}
+
+// record starts a record of a kind at the time at.
+func (l *logWriter) record(kind byte, at time.Time) {
+	l.bytes([]byte{kind})
+	l.uvarint(uint64(at.Sub(l.last)))
+	l.last = at
+}
+
+// cells writes a list of cells, and their values if values is set.
+func (l *logWriter) cells(cells []CellFlipped, values bool) {
+	l.uvarint(uint64(len(cells)))
+	var previous util.Cell
+	for _, cell := range cells {
+		l.varint(cell.Cell.X - previous.X)
+		l.varint(cell.Cell.Y - previous.Y)
+		if values {
+			l.bytes([]byte{cell.Value})
+		}
+		previous = cell.Cell
+	}
+}
+
+// LogEvents writes every event of the run p to w as a binary event log, with a keyframe of the board after
+// every keyframeTurns turns, 0 meaning 100, so that a replay can seek to any turn without reading the whole log.
+// Every event is forwarded to next, if it is not nil, so that LogEvents can sit between Run and another consumer
+// of the events. next is closed and the index of the keyframes written once events is closed.
+func LogEvents(w io.Writer, p Params, events <-chan Event, next chan<- Event, keyframeTurns int) error {
+	if next != nil {
+		defer close(next)
+	}
+	if keyframeTurns < 1 {
+		keyframeTurns = 100
+	}
+	var header bytes.Buffer
+	if err := gob.NewEncoder(&header).Encode(p); err != nil {
+		return err
+	}
+	l := &logWriter{w: bufio.NewWriter(w), last: time.Now()}
+	l.bytes([]byte(eventLogMagic))
+	l.uvarint(uint64(header.Len()))
+	l.bytes(header.Bytes())
+
+	// The board is kept up to date from the events to write the keyframes.
+	board := make(map[util.Cell]uint8)
+	var flipped []CellFlipped
+	var flippedAt time.Time
+	var index []indexEntry
+	lastKeyframe := 0
+	flush := func() {
+		if len(flipped) > 0 {
+			l.record(logCellsFlipped, flippedAt)
+			l.varint(flipped[0].CompletedTurns)
+			l.cells(flipped, true)
+			flipped = flipped[:0]
+		}
+	}
+
+	for event := range events {
+		now := time.Now()
+		if e, ok := event.(CellFlipped); ok {
+			if len(flipped) > 0 && flipped[0].CompletedTurns != e.CompletedTurns {
+				flush()
+			}
+			if len(flipped) == 0 {
+				flippedAt = now
+			}
+			flipped = append(flipped, e)
+			if e.Value == dead {
+				delete(board, e.Cell)
+			} else {
+				board[e.Cell] = e.Value
+			}
+		} else {
+			flush()
+		}
+
+		switch e := event.(type) {
+		case AliveCellsCount:
+			l.record(logAliveCellsCount, now)
+			l.varint(e.CompletedTurns)
+			l.varint(e.CellsCount)
+		case ImageOutputComplete:
+			l.record(logImageOutputComplete, now)
+			l.varint(e.CompletedTurns)
+			l.string(e.Filename)
+		case StateChange:
+			l.record(logStateChange, now)
+			l.varint(e.CompletedTurns)
+			l.varint(int(e.NewState))
+		case TurnDiff:
+			l.record(logTurnDiff, now)
+			l.varint(e.CompletedTurns)
+			l.cells(e.Flipped(), true)
+			for i, cell := range e.Cells {
+				if e.Values[i] == dead {
+					delete(board, cell)
+				} else {
+					board[cell] = e.Values[i]
+				}
+			}
+		case TurnComplete:
+			l.record(logTurnComplete, now)
+			l.varint(e.CompletedTurns)
+			if e.CompletedTurns-lastKeyframe >= keyframeTurns {
+				index = append(index, indexEntry{e.CompletedTurns, l.offset})
+				l.record(logKeyframe, now)
+				l.varint(e.CompletedTurns)
+				l.cells(sortedBoard(board, e.CompletedTurns), true)
+				lastKeyframe = e.CompletedTurns
+			}
+		case FinalTurnComplete:
+			l.record(logFinalTurnComplete, now)
+			l.varint(e.CompletedTurns)
+			l.cells(cellEvents(e.Alive), false)
+			l.cells(cellEvents(e.Dying), false)
+		case TileStats:
+			l.record(logTileStats, now)
+			l.varint(e.CompletedTurns)
+			l.varint(e.Computed)
+			l.varint(e.Skipped)
+		case WorkerLost:
+			l.record(logWorkerLost, now)
+			l.varint(e.CompletedTurns)
+			l.string(e.Worker)
+		case WorkerRecovered:
+			l.record(logWorkerRecovered, now)
+			l.varint(e.CompletedTurns)
+			l.string(e.Worker)
+		}
+		if next != nil {
+			next <- event
+		}
+	}
+	flush()
+
+	indexOffset := l.offset
+	l.uvarint(uint64(len(index)))
+	for _, keyframe := range index {
+		l.varint(keyframe.turn)
+		l.uvarint(uint64(keyframe.offset))
+	}
+	binary.BigEndian.PutUint64(l.buf[:8], uint64(indexOffset))
+	l.bytes(l.buf[:8])
+	l.bytes([]byte(eventIndexMagic))
+	return l.w.Flush()
+}
+
+// sortedBoard returns the cells of a board as CellFlipped events of a turn, in row-major order.
+func sortedBoard(board map[util.Cell]uint8, turn int) []CellFlipped {
+	cells := make([]CellFlipped, 0, len(board))
+	for cell, value := range board {
+		cells = append(cells, CellFlipped{turn, cell, value})
+	}
+	sort.Slice(cells, func(i, j int) bool {
+		a, b := cells[i].Cell, cells[j].Cell
+		return a.Y < b.Y || a.Y == b.Y && a.X < b.X
+	})
+	return cells
+}
+
+// cellEvents returns cells as CellFlipped events to write them to an event log.
+func cellEvents(cells []util.Cell) []CellFlipped {
+	events := make([]CellFlipped, len(cells))
+	for i, cell := range cells {
+		events[i].Cell = cell
+	}
+	return events
+}
+
+// EventLog is an event log written by LogEvents, opened to be replayed.
+type EventLog struct {
+	r      io.ReadSeeker
+	params Params
+	// start and end are the positions of the first record and of the index, or -1 if the log has no index.
+	start, end int64
+	index      []indexEntry
+}
+
+// ReplayOptions are the settings of a replay of an event log.
+type ReplayOptions struct {
+	// Speed is how many times faster than the run the events are replayed, 0 meaning as fast as possible.
+	Speed float64
+	// From is the turn to start the replay at. The board is shown as it was at the TurnComplete event of the turn,
+	// and the events before it are skipped. 0 replays the log from the start.
+	From int
+}
+
+// logReader reads the records of an event log. The first error is kept in err, after which every number read is 0.
+type logReader struct {
+	r   *bufio.Reader
+	err error
+}
+
+// maxLogString is the longest string read from an event log, so that a corrupt length cannot exhaust the memory.
+const maxLogString = 1 << 16
+
+func (l *logReader) varint() int {
+	if l.err != nil {
+		return 0
+	}
+	n, err := binary.ReadVarint(l.r)
+	l.fail(err)
+	return int(n)
+}
+
+func (l *logReader) uvarint() uint64 {
+	if l.err != nil {
+		return 0
+	}
+	n, err := binary.ReadUvarint(l.r)
+	l.fail(err)
+	return n
+}
+
+func (l *logReader) byte() byte {
+	if l.err != nil {
+		return 0
+	}
+	b, err := l.r.ReadByte()
+	l.fail(err)
+	return b
+}
+
+// fail records the error of a read in the middle of a record, where the end of the log means it was cut short.
+func (l *logReader) fail(err error) {
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	if l.err == nil {
+		l.err = err
+	}
+}
+
+func (l *logReader) string() string {
+	n := l.uvarint()
+	if n > maxLogString {
+		l.fail(errors.New("corrupt string in the event log"))
+		return ""
+	}
+	b := make([]byte, n)
+	if l.err == nil {
+		_, err := io.ReadFull(l.r, b)
+		l.fail(err)
+	}
+	return string(b)
+}
+
+func (l *logReader) cells(turn int, values bool) []CellFlipped {
+	n := l.uvarint()
+	var cells []CellFlipped
+	var previous util.Cell
+	for i := uint64(0); i < n && l.err == nil; i++ {
+		cell := CellFlipped{CompletedTurns: turn, Value: alive}
+		cell.Cell.X = previous.X + l.varint()
+		cell.Cell.Y = previous.Y + l.varint()
+		if values {
+			cell.Value = l.byte()
+		}
+		cells = append(cells, cell)
+		previous = cell.Cell
+	}
+	return cells
+}
+
+// next reads the next record and returns its kind, the time since the previous record, its turn and its events.
+// A keyframe is returned as the CellFlipped events of its cells.
+func (l *logReader) next() (byte, time.Duration, int, []Event, error) {
+	kind, err := l.r.ReadByte()
+	if err != nil {
+		return 0, 0, 0, nil, err
+	}
+	delay := time.Duration(l.uvarint())
+	turn := l.varint()
+	var events []Event
+	switch kind {
+	case logAliveCellsCount:
+		events = append(events, AliveCellsCount{turn, l.varint()})
+	case logImageOutputComplete:
+		events = append(events, ImageOutputComplete{turn, l.string()})
+	case logStateChange:
+		events = append(events, StateChange{turn, State(l.varint())})
+	case logCellsFlipped, logKeyframe:
+		for _, cell := range l.cells(turn, true) {
+			events = append(events, cell)
+		}
+	case logTurnDiff:
+		diff := TurnDiff{CompletedTurns: turn}
+		for _, cell := range l.cells(turn, true) {
+			diff.Cells = append(diff.Cells, cell.Cell)
+			diff.Values = append(diff.Values, cell.Value)
+		}
+		events = append(events, diff)
+	case logTurnComplete:
+		events = append(events, TurnComplete{turn})
+	case logFinalTurnComplete:
+		final := FinalTurnComplete{CompletedTurns: turn}
+		for _, cell := range l.cells(turn, false) {
+			final.Alive = append(final.Alive, cell.Cell)
+		}
+		for _, cell := range l.cells(turn, false) {
+			final.Dying = append(final.Dying, cell.Cell)
+		}
+		events = append(events, final)
+	case logTileStats:
+		events = append(events, TileStats{turn, l.varint(), l.varint()})
+	case logWorkerLost:
+		events = append(events, WorkerLost{turn, l.string()})
+	case logWorkerRecovered:
+		events = append(events, WorkerRecovered{turn, l.string()})
+	default:
+		l.fail(fmt.Errorf("unknown record %v in the event log", kind))
+	}
+	if l.err != nil {
+		return kind, 0, turn, nil, l.err
+	}
+	return kind, delay, turn, events, nil
+}
+
+// OpenEventLog opens an event log written by LogEvents. A log without an index, cut short by a crash,
+// can still be replayed from the start up to its last whole record.
+func OpenEventLog(r io.ReadSeeker) (*EventLog, error) {
+	log := &EventLog{r: r, end: -1}
+	b := bufio.NewReader(r)
+	magic := make([]byte, len(eventLogMagic))
+	if _, err := io.ReadFull(b, magic); err != nil || string(magic) != eventLogMagic {
+		return nil, errors.New("not an event log")
+	}
+	length, err := binary.ReadUvarint(b)
+	if err != nil {
+		return nil, err
+	}
+	if length > maxLogString {
+		return nil, errors.New("corrupt header in the event log")
+	}
+	header := make([]byte, length)
+	if _, err := io.ReadFull(b, header); err != nil {
+		return nil, err
+	}
+	if err := gob.NewDecoder(bytes.NewReader(header)).Decode(&log.params); err != nil {
+		return nil, err
+	}
+	log.start = int64(len(eventLogMagic) + binary.PutUvarint(make([]byte, binary.MaxVarintLen64), length) + len(header))
+
+	footer := make([]byte, 8+len(eventIndexMagic))
+	indexEnd, err := r.Seek(-int64(len(footer)), io.SeekEnd)
+	if err != nil {
+		return log, nil
+	}
+	if _, err := io.ReadFull(r, footer); err != nil || string(footer[8:]) != eventIndexMagic {
+		return log, nil
+	}
+	// The index lies between the records and the footer.
+	end := binary.BigEndian.Uint64(footer)
+	if end < uint64(log.start) || end > uint64(indexEnd) {
+		return nil, fmt.Errorf("corrupt index of the event log: it starts at %v, outside the records", end)
+	}
+	log.end = int64(end)
+	if _, err := r.Seek(log.end, io.SeekStart); err != nil {
+		return nil, err
+	}
+	index := &logReader{r: bufio.NewReader(r)}
+	for n := index.uvarint(); n > 0 && index.err == nil; n-- {
+		log.index = append(log.index, indexEntry{index.varint(), int64(index.uvarint())})
+	}
+	if index.err != nil {
+		return nil, fmt.Errorf("corrupt index of the event log: %v", index.err)
+	}
+	return log, nil
+}
+
+// Params returns the parameters of the logged run.
+func (log *EventLog) Params() Params {
+	return log.params
+}
+
+// reader returns a reader of the records from offset up to the index.
+func (log *EventLog) reader(offset int64) (*logReader, error) {
+	if _, err := log.r.Seek(offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+	var r io.Reader = log.r
+	if log.end >= 0 {
+		r = io.LimitReader(log.r, log.end-offset)
+	}
+	return &logReader{r: bufio.NewReader(r)}, nil
+}
+
+// Replay sends the events of the log to events at o.Speed, starting at the turn o.From, and closes events at the end.
+// When starting part of the way through, the board at o.From is sent as a TurnDiff, or as CellFlipped events if the run
+// sent those, built from the last keyframe before it and the records that follow. 'p' on keyPresses, which may be nil, pauses and resumes the replay
+// and 'q' or 'k' stops it, like the keys of a run.
+func (log *EventLog) Replay(events chan<- Event, keyPresses <-chan rune, o ReplayOptions) error {
+	defer close(events)
+	offset := log.start
+	board := make(map[util.Cell]uint8)
+	if o.From > 0 {
+		if i := sort.Search(len(log.index), func(i int) bool { return log.index[i].turn > o.From }); i > 0 {
+			offset = log.index[i-1].offset
+		}
+	}
+	r, err := log.reader(offset)
+	if err != nil {
+		return err
+	}
+
+	// The records before the turn to start from are only read into the board.
+	turn := 0
+	for o.From > 0 && turn < o.From {
+		kind, _, recordTurn, recorded, err := r.next()
+		if err == io.EOF || err == io.ErrUnexpectedEOF && log.end < 0 {
+			break
+		} else if err != nil {
+			return err
+		}
+		for _, event := range recorded {
+			var flipped []CellFlipped
+			switch e := event.(type) {
+			case CellFlipped:
+				flipped = append(flipped, e)
+			case TurnDiff:
+				flipped = e.Flipped()
+			case TurnComplete:
+				turn = e.CompletedTurns
+			}
+			for _, cell := range flipped {
+				if cell.Value != dead {
+					board[cell.Cell] = cell.Value
+				} else {
+					delete(board, cell.Cell)
+				}
+			}
+		}
+		if kind == logKeyframe {
+			turn = recordTurn
+		}
+	}
+	if o.From > 0 {
+		cells := sortedBoard(board, turn)
+		if log.params.CellEvents {
+			for _, cell := range cells {
+				events <- cell
+			}
+		} else if len(cells) > 0 {
+			diff := TurnDiff{CompletedTurns: turn}
+			for _, cell := range cells {
+				diff.Cells = append(diff.Cells, cell.Cell)
+				diff.Values = append(diff.Values, cell.Value)
+			}
+			events <- diff
+		}
+		events <- TurnComplete{turn}
+	}
+
+	start := time.Now()
+	var elapsed time.Duration
+	paused := false
+	// key handles a key press, returning whether the replay stops.
+	key := func(key rune) bool {
+		switch key {
+		case 'p':
+			paused = !paused
+			if paused {
+				events <- StateChange{turn, Paused}
+			} else {
+				// The time spent paused is not made up for.
+				start = time.Now().Add(-log.scaled(elapsed, o.Speed))
+				events <- StateChange{turn, Executing}
+			}
+		case 'q', 'k':
+			events <- StateChange{turn, Quitting}
+			return true
+		}
+		return false
+	}
+	for {
+		kind, delay, _, recorded, err := r.next()
+		if err == io.EOF || err == io.ErrUnexpectedEOF && log.end < 0 {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if kind == logKeyframe {
+			continue
+		}
+
+		// Wait until the record is due, handling the keys pressed meanwhile.
+		elapsed += delay
+		for {
+			var timer *time.Timer
+			var due <-chan time.Time
+			if !paused {
+				wait := start.Add(log.scaled(elapsed, o.Speed)).Sub(time.Now())
+				if wait <= 0 {
+					select {
+					case k := <-keyPresses:
+						if key(k) {
+							return nil
+						}
+						continue
+					default:
+					}
+					break
+				}
+				timer = time.NewTimer(wait)
+				due = timer.C
+			}
+			select {
+			case <-due:
+			case k := <-keyPresses:
+				if timer != nil {
+					timer.Stop()
+				}
+				if key(k) {
+					return nil
+				}
+				continue
+			}
+			break
+		}
+		for _, event := range recorded {
+			events <- event
+			if e, ok := event.(TurnComplete); ok {
+				turn = e.CompletedTurns
+			}
+		}
+	}
+}
+
+// scaled returns the time into a replay at a speed of an event that happened elapsed into the run, 0 at speed 0.
+func (log *EventLog) scaled(elapsed time.Duration, speed float64) time.Duration {
+	if speed <= 0 {
+		return 0
+	}
+	return time.Duration(float64(elapsed) / speed)
+}
@@ -1,25 +1,128 @@
 package gol
 
+import (
+	"errors"
+	"image"
+	"image/color"
+	"io"
+	"os"
+	"time"
+
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
 // Params provides the details of how to run the Game of Life and which image to load.
 type Params struct {
 	Turns       int
 	Threads     int
 	ImageWidth  int
 	ImageHeight int
+	Rule        Rule
+	Topology    Topology
+	Engine      Engine
+	// Step is the number of turns between TurnComplete events on an unbounded plane or with the HashLife engine,
+	// 0 meaning every turn. HashLife computes all of them at once.
+	Step int
+	// CellEvents sends a CellFlipped event for every cell that changes state, as consumers written before TurnDiff expect,
+	// instead of a TurnDiff event per turn.
+	CellEvents bool
+	// Decomposition is how the Cells engine splits a bounded world between the threads.
+	Decomposition Decomposition
+	// Broker is the address of a broker process that computes the turns on worker processes, or empty to compute them locally.
+	Broker string
+	// Peers are the addresses of worker processes that each compute a strip of the world, exchanging their edge rows
+	// directly with each other. The turns are computed locally if it is empty.
+	Peers []string
+	// Workers are the addresses of worker processes that the distributor sends strips of the world to,
+	// recomputing the strips of any worker process that is lost on the others. The turns are computed locally if it is empty.
+	Workers []string
+	// CheckpointTurns is the number of turns between checkpoints, or 0 to only write them on 's' and when quitting.
+	// Checkpoints are written next to Output as <stem>.checkpoint.pgm, or to out/<W>x<H>x<Turns>.checkpoint.pgm
+	// if it is empty or Stdout.
+	CheckpointTurns int
+	// CheckpointPeriod is the time between checkpoints, or 0 to only write them on 's' and when quitting.
+	CheckpointPeriod time.Duration
+	// Resume is the path of a checkpoint to resume the run from, or empty to start from the image.
+	// The board, rule, topology, engine and decomposition recorded in it replace those of the Params,
+	// and so do its turns if Turns is 0.
+	Resume string
+	// Input is the path of the file to read the initial world from instead of images/<W>x<H>.pgm, or "-" for standard input,
+	// in pbm, pgm, png, jpeg, RLE, plaintext (.cells), Life 1.05 or Life 1.06 format, detected from its extension or its header.
+	// The rule recorded in it replaces that of the Params, and so does its topology suffix if it has one.
+	Input string
+	// InputOffset is the position of the top left cell of the input on the board. If it is nil, the input is placed
+	// at the position recorded in the file on an unbounded plane, and otherwise in the centre of the board.
+	InputOffset *image.Point
+	// Output is the path the final image is written to, or "-" for Stdout, and the snapshots before it
+	// to the path with their turn before its extension, or to out/ for Stdout. The image of a run quit early
+	// with 'q' or 'k' is the final one. If it is empty, they are written to out/<W>x<H>x<turn> with the extension of the format.
+	Output string
+	// OutputFormat is the format of the images written out.
+	OutputFormat Format
+	// Palette holds the colours of the states in png images: dead, alive and then the dying states of Generations rules.
+	// A png or jpeg image read with a palette takes the state of the colour each pixel matches exactly.
+	// Without one, images are read by their luminance and written in the grey levels of the pgm images.
+	Palette color.Palette
+	// Threshold is the luminance from which the pixels of a png or jpeg image read without a Palette are alive, 0 meaning 128.
+	Threshold uint8
+	// Scale is the width and height in pixels of every cell of the png images written, 0 meaning 1.
+	Scale int
+	// Compress gzips the images written out, adding .gz to their names. Images written to an Output path
+	// ending in .gz are compressed either way.
+	Compress bool
+
+	// input is the world read from Input by ReadInput.
+	input *util.Pattern
+	// image holds the cells of images/<W>x<H>.pgm read by ReadInput if there is no Input.
+	image []uint8
+	// resumed and resumedCells hold the checkpoint read from Resume by resumeParams and its raster,
+	// so that the checkpoint is read only once however often resumeParams is called on the result.
+	resumed      *checkpoint
+	resumedCells []byte
+}
+
+// Stdout is where the images written to the path "-" go. It keeps the standard output the program started with,
+// so that a program can send its other messages elsewhere by replacing os.Stdout.
+var Stdout io.Writer = os.Stdout
+
+// CheckParams returns an error for parameters that cannot be simulated.
+func CheckParams(p Params) error {
+	// A B0 rule brings every cell of an unbounded plane to life at once.
+	if p.Topology == Unbounded && p.Rule.Birth[0] {
+		return errors.New("B0 rules cannot be simulated on an unbounded plane")
+	}
+	return nil
 }
 
 // Run starts the processing of Game of Life. It should initialise channels and goroutines.
+// A checkpoint or input already read into p, as Serve does before starting it, is not read again.
 func Run(p Params, events chan<- Event, keyPresses <-chan rune) {
+	p, err := resumeParams(p)
+	util.Check(err)
+	util.Check(CheckParams(p))
+	p, err = ReadInput(p)
+	util.Check(err)
+	p.Rule = p.Rule.orDefault()
 
 	ioCommand := make(chan ioCommand)
 	ioIdle := make(chan bool)
 	ioFilename := make(chan string)
 	ioOutput := make(chan uint8)
 	ioInput := make(chan uint8)
+	ioRegion := make(chan image.Rectangle)
+	ioTurn := make(chan int)
 
-	var stopResume [16]chan bool
+	if p.Threads < 1 {
+		p.Threads = 1
+	}
+	// A bounded world is split into a grid of workers with at least one cell each.
+	if p.Topology != Unbounded {
+		rows, columns := workerGrid(p)
+		p.Threads = rows * columns
+	}
 
-	for i := 0; i < 16; i++ {
+	stopResume := make([]chan bool, p.Threads)
+	for i := range stopResume {
 		stopResume[i] = make(chan bool, 2)
 	}
 
@@ -30,8 +133,10 @@ func Run(p Params, events chan<- Event, keyPresses <-chan rune) {
 		ioFilename,
 		ioOutput,
 		ioInput,
+		ioRegion,
 		keyPresses,
 		stopResume,
+		ioTurn,
 	}
 	go distributor(p, distributorChannels)
 
@@ -41,6 +146,8 @@ func Run(p Params, events chan<- Event, keyPresses <-chan rune) {
 		filename: ioFilename,
 		output:   ioOutput,
 		input:    ioInput,
+		region:   ioRegion,
+		turn:     ioTurn,
 	}
 
 	go startIo(p, ioChannels)
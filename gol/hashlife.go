@@ -0,0 +1,459 @@
+package gol
+
+import (
+	"fmt"
+	"image"
+
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// maxNodes is the size of the node cache above which unreachable nodes are garbage collected.
+const maxNodes = 1 << 22
+
+// node is a square of 2^level x 2^level cells in a quadtree. Nodes are canonicalised (hash-consed),
+// so equal squares are the same node and the result of a node only has to be computed once.
+// Leaves (level 0) are single cells and have no children.
+type node struct {
+	nw, ne, sw, se *node
+	level          uint
+	population     int
+
+	// result is the centre 2^(level-1) square after 2^resultStep turns.
+	result     *node
+	resultStep uint
+}
+
+type nodeKey struct {
+	nw, ne, sw, se *node
+}
+
+// hashLife holds the node cache. It either simulates a torus, by tiling copies of the board,
+// or an unbounded plane, by padding the root with empty nodes as the pattern grows.
+type hashLife struct {
+	p Params
+	c distributorChannels
+
+	nodes      map[nodeKey]*node
+	deadLeaf   *node
+	aliveLeaf  *node
+	emptyNodes []*node
+
+	// root holds the world. Its top left cell is at origin.
+	root   *node
+	origin image.Point
+	torus  bool
+
+	// previous is the last snapshot of a torus, or the alive cells of an unbounded plane, used to find flipped cells.
+	previous      [][]uint8
+	previousAlive map[util.Cell]bool
+}
+
+// hashLifeSupports returns an error if HashLife cannot simulate a bounded world with the given parameters.
+func hashLifeSupports(p Params) error {
+	if p.Rule.stateCount() != 2 {
+		return fmt.Errorf("HashLife does not support Generations rules")
+	}
+	if p.Topology != Torus {
+		return fmt.Errorf("HashLife only supports a torus or an unbounded plane, not a %v", p.Topology)
+	}
+	if !isPowerOfTwo(p.ImageWidth) || !isPowerOfTwo(p.ImageHeight) {
+		return fmt.Errorf("HashLife needs a torus whose sides are powers of two, not %vx%v", p.ImageWidth, p.ImageHeight)
+	}
+	return nil
+}
+
+func isPowerOfTwo(n int) bool {
+	return n > 0 && n&(n-1) == 0
+}
+
+func newHashLife(p Params, c distributorChannels) *hashLife {
+	h := &hashLife{
+		p:         p,
+		c:         c,
+		nodes:     make(map[nodeKey]*node),
+		deadLeaf:  &node{},
+		aliveLeaf: &node{population: 1},
+	}
+	h.emptyNodes = []*node{h.deadLeaf}
+	return h
+}
+
+// newTorusHashLife returns a HashLife engine for a torus. The root is a square of the size of the longer side,
+// holding copies of the board if it is not square.
+func newTorusHashLife(p Params, c distributorChannels, world [][]uint8) *hashLife {
+	h := newHashLife(p, c)
+	h.torus = true
+	size := p.ImageWidth
+	if p.ImageHeight > size {
+		size = p.ImageHeight
+	}
+	h.root = h.build(log2(size), 0, 0, func(x, y int) bool {
+		return world[y%p.ImageHeight][x%p.ImageWidth] == alive
+	})
+	h.previous = h.snapshot()
+	return h
+}
+
+// newUnboundedHashLife returns a HashLife engine for an unbounded plane.
+func newUnboundedHashLife(p Params, c distributorChannels, world sparseWorld) *hashLife {
+	h := newHashLife(p, c)
+	region := world.bounds()
+	size := 4
+	for size < region.Dx() || size < region.Dy() {
+		size *= 2
+	}
+	h.origin = region.Min
+	h.root = h.build(log2(size), region.Min.X, region.Min.Y, func(x, y int) bool {
+		return world.get(x, y) == alive
+	})
+	h.previousAlive = h.aliveSet()
+	return h
+}
+
+func log2(n int) uint {
+	level := uint(0)
+	for 1<<level < n {
+		level++
+	}
+	return level
+}
+
+// build returns the node of the given level whose top left cell is (x, y).
+func (h *hashLife) build(level uint, x, y int, isAlive func(x, y int) bool) *node {
+	if level == 0 {
+		if isAlive(x, y) {
+			return h.aliveLeaf
+		}
+		return h.deadLeaf
+	}
+	half := 1 << (level - 1)
+	return h.join(
+		h.build(level-1, x, y, isAlive),
+		h.build(level-1, x+half, y, isAlive),
+		h.build(level-1, x, y+half, isAlive),
+		h.build(level-1, x+half, y+half, isAlive),
+	)
+}
+
+// join returns the canonical node with the given quadrants.
+func (h *hashLife) join(nw, ne, sw, se *node) *node {
+	key := nodeKey{nw, ne, sw, se}
+	if n, ok := h.nodes[key]; ok {
+		return n
+	}
+	n := &node{
+		nw:         nw,
+		ne:         ne,
+		sw:         sw,
+		se:         se,
+		level:      nw.level + 1,
+		population: nw.population + ne.population + sw.population + se.population,
+	}
+	h.nodes[key] = n
+	return n
+}
+
+// empty returns the node of the given level with no alive cells.
+func (h *hashLife) empty(level uint) *node {
+	for uint(len(h.emptyNodes)) <= level {
+		e := h.emptyNodes[len(h.emptyNodes)-1]
+		h.emptyNodes = append(h.emptyNodes, h.join(e, e, e, e))
+	}
+	return h.emptyNodes[level]
+}
+
+// expand returns a node twice the size of n with n in its centre.
+func (h *hashLife) expand(n *node) *node {
+	e := h.empty(n.level - 1)
+	return h.join(
+		h.join(e, e, e, n.nw),
+		h.join(e, e, n.ne, e),
+		h.join(e, n.sw, e, e),
+		h.join(n.se, e, e, e),
+	)
+}
+
+// centre returns the centre half of n.
+func (h *hashLife) centre(n *node) *node {
+	return h.join(n.nw.se, n.ne.sw, n.sw.ne, n.se.nw)
+}
+
+// centreHorizontal returns the node between two horizontally adjacent nodes.
+func (h *hashLife) centreHorizontal(w, e *node) *node {
+	return h.join(w.ne, e.nw, w.se, e.sw)
+}
+
+// centreVertical returns the node between two vertically adjacent nodes.
+func (h *hashLife) centreVertical(n, s *node) *node {
+	return h.join(n.sw, n.se, s.nw, s.ne)
+}
+
+// successor returns the centre half of n after 2^step turns, with step at most level-2.
+func (h *hashLife) successor(n *node, step uint) *node {
+	if step > n.level-2 {
+		step = n.level - 2
+	}
+	if n.population == 0 && !h.p.Rule.Birth[0] {
+		return h.empty(n.level - 1)
+	}
+	if n.result != nil && n.resultStep == step {
+		return n.result
+	}
+
+	var result *node
+	if n.level == 2 {
+		result = h.calculateNextBlock(n)
+	} else {
+		// The nine overlapping sub-squares of half the size of n.
+		subs := [3][3]*node{
+			{n.nw, h.centreHorizontal(n.nw, n.ne), n.ne},
+			{h.centreVertical(n.nw, n.sw), h.centre(n), h.centreVertical(n.ne, n.se)},
+			{n.sw, h.centreHorizontal(n.sw, n.se), n.se},
+		}
+		// At full speed both halves of the time step are computed recursively,
+		// otherwise the first half only takes the centres and the second half advances 2^step turns.
+		secondStep := step
+		var first [3][3]*node
+		for i := range subs {
+			for j := range subs[i] {
+				if step == n.level-2 {
+					first[i][j] = h.successor(subs[i][j], step-1)
+				} else {
+					first[i][j] = h.centre(subs[i][j])
+				}
+			}
+		}
+		if step == n.level-2 {
+			secondStep = step - 1
+		}
+		result = h.join(
+			h.successor(h.join(first[0][0], first[0][1], first[1][0], first[1][1]), secondStep),
+			h.successor(h.join(first[0][1], first[0][2], first[1][1], first[1][2]), secondStep),
+			h.successor(h.join(first[1][0], first[1][1], first[2][0], first[2][1]), secondStep),
+			h.successor(h.join(first[1][1], first[1][2], first[2][1], first[2][2]), secondStep),
+		)
+	}
+	n.result = result
+	n.resultStep = step
+	return result
+}
+
+// calculateNextBlock returns the centre 2x2 cells of a 4x4 node after one turn.
+func (h *hashLife) calculateNextBlock(n *node) *node {
+	var cells [4][4]bool
+	for y, row := range [2][2]*node{{n.nw, n.ne}, {n.sw, n.se}} {
+		for x, quadrant := range row {
+			cells[2*y][2*x] = quadrant.nw == h.aliveLeaf
+			cells[2*y][2*x+1] = quadrant.ne == h.aliveLeaf
+			cells[2*y+1][2*x] = quadrant.sw == h.aliveLeaf
+			cells[2*y+1][2*x+1] = quadrant.se == h.aliveLeaf
+		}
+	}
+	var next [2][2]*node
+	for y := 1; y <= 2; y++ {
+		for x := 1; x <= 2; x++ {
+			neighbours := 0
+			for i := -1; i <= 1; i++ {
+				for j := -1; j <= 1; j++ {
+					if (i != 0 || j != 0) && cells[y+i][x+j] {
+						neighbours++
+					}
+				}
+			}
+			value := uint8(dead)
+			if cells[y][x] {
+				value = alive
+			}
+			next[y-1][x-1] = h.deadLeaf
+			if h.p.Rule.next(value, neighbours) == alive {
+				next[y-1][x-1] = h.aliveLeaf
+			}
+		}
+	}
+	return h.join(next[0][0], next[0][1], next[1][0], next[1][1])
+}
+
+// advance moves the world forward by 2^step turns.
+func (h *hashLife) advance(step uint) {
+	if h.torus {
+		// The root of a torus holds one period of the world. Surrounded by copies of itself it becomes
+		// four times larger, and the top left quarter of its successor is again one period of the world.
+		quad := h.join(h.root, h.root, h.root, h.root)
+		h.root = h.successor(h.join(quad, quad, quad, quad), step).nw
+	} else {
+		// The pattern must stay within the centre half of the root while it grows for 2^step turns.
+		for h.root.level < step+2 || h.centre(h.root).population != h.root.population {
+			h.expandRoot()
+		}
+		h.expandRoot()
+		size := 1 << h.root.level
+		h.root = h.successor(h.root, step)
+		h.origin = h.origin.Add(image.Pt(size/4, size/4))
+	}
+	if len(h.nodes) > maxNodes {
+		h.collectGarbage()
+	}
+}
+
+func (h *hashLife) expandRoot() {
+	size := 1 << h.root.level
+	h.root = h.expand(h.root)
+	h.origin = h.origin.Sub(image.Pt(size/2, size/2))
+}
+
+// collectGarbage drops every node that is not reachable from the root and forgets all memoised results.
+func (h *hashLife) collectGarbage() {
+	nodes := make(map[nodeKey]*node)
+	var mark func(n *node)
+	mark = func(n *node) {
+		if n.level == 0 {
+			return
+		}
+		key := nodeKey{n.nw, n.ne, n.sw, n.se}
+		if _, ok := nodes[key]; ok {
+			return
+		}
+		n.result = nil
+		nodes[key] = n
+		mark(n.nw)
+		mark(n.ne)
+		mark(n.sw)
+		mark(n.se)
+	}
+	mark(h.root)
+	for _, e := range h.emptyNodes {
+		mark(e)
+	}
+	h.nodes = nodes
+}
+
+func (h *hashLife) next(turn, n int) {
+	for n > 0 {
+		// Advance by the largest power of two that fits, which on a torus may not exceed the size of the root.
+		step := uint(0)
+		for 1<<(step+1) <= n && (!h.torus || step+1 <= h.root.level) {
+			step++
+		}
+		h.advance(step)
+		n -= 1 << step
+		turn += 1 << step
+	}
+
+	if h.torus {
+		world := h.snapshot()
+		sendFlippedCells(h.p, h.c, turn-1, h.previous, world)
+		h.previous = world
+	} else {
+		aliveSet := h.aliveSet()
+		var diff flips
+		for cell := range h.previousAlive {
+			if !aliveSet[cell] {
+				diff.add(cell.X, cell.Y, dead)
+			}
+		}
+		for cell := range aliveSet {
+			if !h.previousAlive[cell] {
+				diff.add(cell.X, cell.Y, alive)
+			}
+		}
+		diff.send(h.p, h.c, turn-1)
+		h.previousAlive = aliveSet
+	}
+}
+
+// snapshot returns the world of a torus indexed [y][x].
+func (h *hashLife) snapshot() [][]uint8 {
+	world := make([][]uint8, h.p.ImageHeight)
+	for y := range world {
+		world[y] = make([]uint8, h.p.ImageWidth)
+		for x := range world[y] {
+			world[y][x] = h.get(x, y)
+		}
+	}
+	return world
+}
+
+func (h *hashLife) aliveSet() map[util.Cell]bool {
+	set := make(map[util.Cell]bool)
+	for _, cell := range h.cells(func(value uint8) bool { return value == alive }) {
+		set[cell] = true
+	}
+	return set
+}
+
+func (h *hashLife) population() int {
+	if h.torus {
+		// The root of a non-square torus holds several copies of the board.
+		copies := (1 << h.root.level) * (1 << h.root.level) / (h.p.ImageWidth * h.p.ImageHeight)
+		return h.root.population / copies
+	}
+	return h.root.population
+}
+
+func (h *hashLife) cells(match func(uint8) bool) []util.Cell {
+	var cells []util.Cell
+	var walk func(n *node, x, y int)
+	walk = func(n *node, x, y int) {
+		if h.torus && (x >= h.p.ImageWidth || y >= h.p.ImageHeight) {
+			// Skip the copies of a non-square board.
+			return
+		}
+		if n.level == 0 {
+			value := uint8(dead)
+			if n == h.aliveLeaf {
+				value = alive
+			}
+			if match(value) {
+				cells = append(cells, util.Cell{X: x, Y: y})
+			}
+			return
+		}
+		if n.population == 0 && !match(dead) {
+			return
+		}
+		half := 1 << (n.level - 1)
+		walk(n.nw, x, y)
+		walk(n.ne, x+half, y)
+		walk(n.sw, x, y+half)
+		walk(n.se, x+half, y+half)
+	}
+	walk(h.root, h.origin.X, h.origin.Y)
+	return cells
+}
+
+func (h *hashLife) bounds() image.Rectangle {
+	if h.torus {
+		return image.Rect(0, 0, h.p.ImageWidth, h.p.ImageHeight)
+	}
+	var r image.Rectangle
+	for _, cell := range h.cells(func(value uint8) bool { return value == alive }) {
+		r = r.Union(image.Rect(cell.X, cell.Y, cell.X+1, cell.Y+1))
+	}
+	return r
+}
+
+func (h *hashLife) get(x, y int) uint8 {
+	n := h.root
+	x -= h.origin.X
+	y -= h.origin.Y
+	if x < 0 || y < 0 || x >= 1<<n.level || y >= 1<<n.level {
+		return dead
+	}
+	for n.level > 0 {
+		half := 1 << (n.level - 1)
+		switch {
+		case x < half && y < half:
+			n = n.nw
+		case y < half:
+			n, x = n.ne, x-half
+		case x < half:
+			n, y = n.sw, y-half
+		default:
+			n, x, y = n.se, x-half, y-half
+		}
+	}
+	if n == h.aliveLeaf {
+		return alive
+	}
+	return dead
+}
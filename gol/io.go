@@ -1,10 +1,13 @@
 package gol
 
 import (
+	"bufio"
+	"compress/gzip"
 	"fmt"
-	"io/ioutil"
+	"image"
+	"io"
 	"os"
-	"strconv"
+	"path/filepath"
 	"strings"
 
 	"uk.ac.bris.cs/gameoflife/util"
@@ -17,12 +20,16 @@ type ioChannels struct {
 	filename <-chan string
 	output   <-chan uint8
 	input    chan<- uint8
+	region   chan image.Rectangle
+	turn     chan int
 }
 
 // ioState is the internal ioState of the io goroutine.
 type ioState struct {
 	params   Params
 	channels ioChannels
+	// quitting is set by ioQuitting once the run is quitting early, so that the image written then is the final one.
+	quitting bool
 }
 
 // ioCommand allows requesting behaviour from the io (pgm) goroutine.
@@ -33,92 +40,312 @@ type ioCommand uint8
 //		ioOutput 	= 0
 //		ioInput 	= 1
 //		ioCheckIdle = 2
+//		ioOutputRegion = 3
+//		ioInputRegion = 4
+//		ioOutputCheckpoint = 5
+//		ioInputCheckpoint = 6
+//		ioOutputPattern = 7
+//		ioInputPattern = 8
+//		ioQuitting = 9
 const (
 	ioOutput ioCommand = iota
 	ioInput
 	ioCheckIdle
+	ioOutputRegion
+	ioInputRegion
+	ioOutputCheckpoint
+	ioInputCheckpoint
+	ioOutputPattern
+	ioInputPattern
+	ioQuitting
 )
 
-// writePgmImage receives an array of bytes and writes it to a pgm file.
-func (io *ioState) writePgmImage() {
-	_ = os.Mkdir("out", os.ModePerm)
+// createOutput creates the file the image after turn completed turns is written to: the path of p.Output, Stdout if it is "-",
+// or out/<filename>.<extension> if it is empty. Only the final image, after p.Turns or when quitting early, is written to p.Output.
+// The snapshots taken before it go to <stem>.<turn><extension> next to it, or to out/ if it is Stdout.
+// The image is gzipped if p.Compress is set or the path ends in .gz. The returned function flushes the image and closes the file.
+func createOutput(p Params, filename, extension string, turn int, final bool) (*bufio.Writer, func()) {
+	path := p.Output
+	if path != "" && path != "-" && !final {
+		path = snapshotPath(path, turn)
+	}
+	if path == "" || path == "-" && !final {
+		_ = os.Mkdir("out", os.ModePerm)
+		path = "out/" + filename + "." + extension
+		if p.Compress {
+			path += ".gz"
+		}
+	}
+	var file *os.File
+	var out io.Writer = Stdout
+	if path != "-" {
+		var ioError error
+		file, ioError = os.Create(path)
+		util.Check(ioError)
+		out = file
+	}
+	var compressed *gzip.Writer
+	if p.Compress || strings.HasSuffix(path, ".gz") {
+		compressed = gzip.NewWriter(out)
+		out = compressed
+	}
+	w := bufio.NewWriter(out)
+	return w, func() {
+		util.Check(w.Flush())
+		if compressed != nil {
+			util.Check(compressed.Close())
+		}
+		if file != nil {
+			util.Check(file.Sync())
+			util.Check(file.Close())
+		}
+	}
+}
 
-	filename := <-io.channels.filename
-	file, ioError := os.Create("out/" + filename + ".pgm")
-	util.Check(ioError)
-	defer file.Close()
-
-	_, _ = file.WriteString("P5\n")
-	//_, _ = file.WriteString("# PGM file writer by pnmmodules (https://github.com/owainkenwayucl/pnmmodules).\n")
-	_, _ = file.WriteString(strconv.Itoa(io.params.ImageWidth))
-	_, _ = file.WriteString(" ")
-	_, _ = file.WriteString(strconv.Itoa(io.params.ImageHeight))
-	_, _ = file.WriteString("\n")
-	_, _ = file.WriteString(strconv.Itoa(255))
-	_, _ = file.WriteString("\n")
-
-	world := make([][]byte, io.params.ImageHeight)
-	for i := range world {
-		world[i] = make([]byte, io.params.ImageWidth)
-	}
-
-	for y := 0; y < io.params.ImageHeight; y++ {
-		for x := 0; x < io.params.ImageWidth; x++ {
-			val := <-io.channels.output
-			//if val != 0 {
-			//	fmt.Println(x, y)
-			//}
-			world[y][x] = val
+// final returns whether the image after turn completed turns is the final one: after p.Turns, or when quitting early.
+func (io *ioState) final(turn int) bool {
+	return turn == io.params.Turns || io.quitting
+}
+
+// snapshotPath returns the path of the snapshot after turn completed turns when the final image is written to path:
+// path with the turn inserted before its extension, such as board.40.pgm for board.pgm and board.40.pgm.gz for board.pgm.gz.
+func snapshotPath(path string, turn int) string {
+	extension := filepath.Ext(path)
+	if extension == ".gz" {
+		extension = filepath.Ext(strings.TrimSuffix(path, extension)) + extension
+	}
+	return fmt.Sprintf("%v.%v%v", strings.TrimSuffix(path, extension), turn, extension)
+}
+
+// checkpointPath returns the path of the checkpoint named filename: next to p.Output as <stem>.checkpoint.pgm,
+// such as board.checkpoint.pgm for board.png or board.pgm.gz, or out/<filename>.pgm if p.Output is empty or Stdout.
+func checkpointPath(p Params, filename string) string {
+	if p.Output == "" || p.Output == "-" {
+		_ = os.Mkdir("out", os.ModePerm)
+		return "out/" + filename + ".pgm"
+	}
+	path := strings.TrimSuffix(p.Output, ".gz")
+	return strings.TrimSuffix(path, filepath.Ext(path)) + ".checkpoint.pgm"
+}
+
+// openImage opens images/<filename>.pgm, or images/<filename>.pgm.gz if there is only a gzipped image, and decompresses it.
+func openImage(filename string) (io.Reader, func() error, error) {
+	file, ioError := os.Open("images/" + filename + ".pgm")
+	if os.IsNotExist(ioError) {
+		if gzipped, err := os.Open("images/" + filename + ".pgm.gz"); err == nil {
+			file, ioError = gzipped, nil
 		}
 	}
+	if ioError != nil {
+		return nil, nil, ioError
+	}
+	r, err := util.Uncompressed(file)
+	if err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+	return r, file.Close, nil
+}
+
+// readPgmImage reads images/<W>x<H>.pgm, the initial world of a bounded board without an input, into p
+// unless it has been read already. It returns an error if the image cannot be read or is not the size of the board.
+func readPgmImage(p Params) (Params, error) {
+	if p.Topology == Unbounded || p.image != nil {
+		return p, nil
+	}
+	filename := fmt.Sprintf("%vx%v", p.ImageWidth, p.ImageHeight)
+	file, closeImage, err := openImage(filename)
+	if err != nil {
+		return p, err
+	}
+	defer closeImage()
+
+	header, pixels, err := util.ReadPgm(file)
+	if err != nil {
+		return p, fmt.Errorf("images/%v.pgm: %v", filename, err)
+	}
+	if header.Width != p.ImageWidth || header.Height != p.ImageHeight {
+		return p, fmt.Errorf("images/%v.pgm is %vx%v, not %vx%v like the board",
+			filename, header.Width, header.Height, p.ImageWidth, p.ImageHeight)
+	}
+	p.image = pixels
+	return p, nil
+}
 
-	for y := 0; y < io.params.ImageHeight; y++ {
-		for x := 0; x < io.params.ImageWidth; x++ {
-			_, ioError = file.Write([]byte{world[y][x]})
-			util.Check(ioError)
+// writeImage writes the pixels of an image in the output format: a binary pgm, a bit-packed pbm (P4),
+// in which the dying cells of Generations rules are written as dead as it only has two states, or a png,
+// which does not record the origin of a region of an unbounded plane.
+func (io *ioState) writeImage(w *bufio.Writer, header util.PgmHeader, pixels []byte) {
+	switch io.params.OutputFormat {
+	case PBM:
+		header.Magic = "P4"
+		for i, value := range pixels {
+			if value != alive {
+				pixels[i] = dead
+			}
 		}
+	case PNG:
+		util.Check(writePng(w, io.params, header.Width, header.Height, pixels))
+		return
 	}
+	util.Check(util.WritePgm(w, header, pixels))
+}
 
-	ioError = file.Sync()
-	util.Check(ioError)
+// writePgmImage receives the completed turns and an array of bytes and writes it to a pgm file.
+func (io *ioState) writePgmImage() {
+	filename := <-io.channels.filename
+	turn := <-io.channels.turn
+	file, done := createOutput(io.params, filename, io.params.OutputFormat.extension(), turn, io.final(turn))
+
+	header := util.PgmHeader{Width: io.params.ImageWidth, Height: io.params.ImageHeight}
+	pixels := make([]byte, header.Width*header.Height)
+	for i := range pixels {
+		pixels[i] = <-io.channels.output
+	}
+	io.writeImage(file, header, pixels)
+	done()
 
 	fmt.Println("File", filename, "output done!")
 }
 
-// readPgmImage opens a pgm file and sends its data as an array of bytes.
+// readPgmImage sends the cells of the image of the board read by ReadInput.
 func (io *ioState) readPgmImage() {
 	filename := <-io.channels.filename
-	data, ioError := ioutil.ReadFile("images/" + filename + ".pgm")
-	util.Check(ioError)
+	for _, b := range io.params.image {
+		io.channels.input <- b
+	}
 
-	fields := strings.Fields(string(data))
+	fmt.Println("File", filename, "input done!")
+}
 
-	if fields[0] != "P5" {
-		panic("Not a pgm file")
-	}
+// writePgmRegion receives the completed turns and a region of an unbounded world followed by its cells and writes them
+// to a pgm file. The position of the region is recorded in an "# origin x y" comment.
+func (io *ioState) writePgmRegion() {
+	filename := <-io.channels.filename
+	turn := <-io.channels.turn
+	region := <-io.channels.region
+	file, done := createOutput(io.params, filename, io.params.OutputFormat.extension(), turn, io.final(turn))
 
-	width, _ := strconv.Atoi(fields[1])
-	if width != io.params.ImageWidth {
-		panic("Incorrect width")
+	pixels := make([]byte, region.Dx()*region.Dy())
+	for i := range pixels {
+		pixels[i] = <-io.channels.output
 	}
 
-	height, _ := strconv.Atoi(fields[2])
-	if height != io.params.ImageHeight {
-		panic("Incorrect height")
+	header := util.PgmHeader{Width: region.Dx(), Height: region.Dy(), Origin: region.Min}
+	io.writeImage(file, header, pixels)
+	done()
+
+	fmt.Println("File", filename, "output done!")
+}
+
+// readPgmRegion opens a pgm file of any size and sends the region it covers on an unbounded world, followed by its cells.
+func (io *ioState) readPgmRegion() {
+	filename := <-io.channels.filename
+	file, closeImage, err := openImage(filename)
+	util.Check(err)
+	defer closeImage()
+
+	header, pixels, err := util.ReadPgm(file)
+	util.Check(err)
+
+	io.channels.region <- image.Rect(0, 0, header.Width, header.Height).Add(header.Origin)
+	for _, b := range pixels {
+		io.channels.input <- b
 	}
 
-	maxval, _ := strconv.Atoi(fields[3])
-	if maxval != 255 {
-		panic("Incorrect maxval/bit depth")
+	fmt.Println("File", filename, "input done!")
+}
+
+// writeCheckpoint receives the completed turns and a region of the world followed by its cells and writes a checkpoint.
+// It is written to a temporary file which then replaces the last checkpoint, so a crash while writing does not lose both.
+func (io *ioState) writeCheckpoint() {
+	filename := <-io.channels.filename
+	turn := <-io.channels.turn
+	region := <-io.channels.region
+	pixels := make([]byte, region.Dx()*region.Dy())
+	for i := range pixels {
+		pixels[i] = <-io.channels.output
 	}
 
-	image := []byte(fields[4])
+	path := checkpointPath(io.params, filename)
+	file, ioError := os.Create(path + ".tmp")
+	util.Check(ioError)
+	_, ioError = file.WriteString(checkpointHeader(io.params, turn, region))
+	util.Check(ioError)
+	_, ioError = file.Write(pixels)
+	util.Check(ioError)
+	util.Check(file.Sync())
+	util.Check(file.Close())
+	util.Check(os.Rename(path+".tmp", path))
 
-	for _, b := range image {
+	fmt.Println("File", filename, "output done!")
+}
+
+// readCheckpoint opens the checkpoint at the path received, unless resumeParams has read it already, and sends its completed turns and region, followed by its cells.
+func (io *ioState) readCheckpoint() {
+	path := <-io.channels.filename
+	var cp checkpoint
+	var pixels []byte
+	if io.params.resumed != nil && path == io.params.Resume {
+		cp, pixels = *io.params.resumed, io.params.resumedCells
+	} else {
+		var err error
+		cp, pixels, err = readCheckpoint(path)
+		util.Check(err)
+	}
+
+	io.channels.turn <- cp.turn
+	io.channels.region <- cp.region
+	for _, b := range pixels {
 		io.channels.input <- b
 	}
 
-	fmt.Println("File", filename, "input done!")
+	fmt.Println("File", path, "input done!")
+}
+
+// writePattern receives the completed turns and a region of the world followed by its cells and writes them
+// to a pattern file in the output format, together with the rule and, on a bounded board, the topology if the format records them.
+func (io *ioState) writePattern() {
+	filename := <-io.channels.filename
+	turn := <-io.channels.turn
+	region := <-io.channels.region
+	pattern := util.Pattern{
+		Width:    region.Dx(),
+		Height:   region.Dy(),
+		Cells:    make([]uint8, region.Dx()*region.Dy()),
+		Rule:     io.params.Rule.String(),
+		Name:     filename,
+		Comments: []string{fmt.Sprintf("Generation %d", turn)},
+	}
+	for i := range pattern.Cells {
+		pattern.Cells[i] = uint8(io.params.Rule.state(<-io.channels.output))
+	}
+	if io.params.Topology == Unbounded {
+		pattern.Origin = region.Min
+		pattern.Positioned = true
+	} else {
+		pattern.Rule += ":" + io.params.Topology.golly(io.params.ImageWidth, io.params.ImageHeight)
+	}
+
+	file, done := createOutput(io.params, filename, io.params.OutputFormat.extension(), turn, io.final(turn))
+	util.Check(writePatternFile(file, io.params.OutputFormat, pattern))
+	done()
+
+	fmt.Println("File", filename, "output done!")
+}
+
+// readPattern sends the region of the board the input read by ReadInput from the path received is placed on,
+// followed by its cells.
+func (io *ioState) readPattern() {
+	path := <-io.channels.filename
+	pattern := *io.params.input
+
+	io.channels.region <- patternRect(io.params, pattern)
+	for _, state := range pattern.Cells {
+		io.channels.input <- io.params.Rule.value(int(state))
+	}
+
+	fmt.Println("File", path, "input done!")
 }
 
 // startIo should be the entrypoint of the io goroutine.
@@ -138,6 +365,20 @@ func startIo(p Params, c ioChannels) {
 				io.writePgmImage()
 			case ioCheckIdle:
 				io.channels.idle <- true
+			case ioOutputRegion:
+				io.writePgmRegion()
+			case ioInputRegion:
+				io.readPgmRegion()
+			case ioOutputCheckpoint:
+				io.writeCheckpoint()
+			case ioInputCheckpoint:
+				io.readCheckpoint()
+			case ioOutputPattern:
+				io.writePattern()
+			case ioInputPattern:
+				io.readPattern()
+			case ioQuitting:
+				io.quitting = true
 			}
 		}
 	}
@@ -0,0 +1,322 @@
+package gol
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// Events are written as JSON Lines, one object per line with the name of the event type in "type",
+// the completed turns in "turn" and the fields of the event, e.g.
+//
+//	{"type":"AliveCellsCount","turn":42,"cells":5565}
+//	{"type":"ImageOutputComplete","turn":42,"filename":"64x64x42"}
+//	{"type":"StateChange","turn":42,"state":"Paused"}
+//	{"type":"CellFlipped","turn":42,"x":3,"y":7,"value":255}
+//	{"type":"TurnDiff","turn":42,"flipped":[[3,7,255],[4,7,0]]}
+//	{"type":"TurnComplete","turn":42}
+//	{"type":"FinalTurnComplete","turn":100,"alive":[[3,7],[4,7]],"dying":[]}
+//	{"type":"TileStats","turn":42,"computed":12,"skipped":52}
+//	{"type":"WorkerLost","turn":42,"worker":"localhost:8031"}
+//	{"type":"WorkerRecovered","turn":43,"worker":"localhost:8031"}
+//
+// Every field is always present, and new fields are only ever added, so that the schema stays stable for the readers.
+
+// EventTypes are the names of the event types in the "type" field of the JSON events.
+var EventTypes = []string{
+	"AliveCellsCount", "ImageOutputComplete", "StateChange", "CellFlipped", "TurnDiff", "TurnComplete",
+	"FinalTurnComplete", "TileStats", "WorkerLost", "WorkerRecovered",
+}
+
+type jsonEvent struct {
+	Type string `json:"type"`
+	Turn int    `json:"turn"`
+}
+
+type jsonAliveCellsCount struct {
+	jsonEvent
+	Cells int `json:"cells"`
+}
+
+type jsonImageOutputComplete struct {
+	jsonEvent
+	Filename string `json:"filename"`
+}
+
+type jsonStateChange struct {
+	jsonEvent
+	State string `json:"state"`
+}
+
+type jsonCellFlipped struct {
+	jsonEvent
+	X     int   `json:"x"`
+	Y     int   `json:"y"`
+	Value uint8 `json:"value"`
+}
+
+type jsonTurnDiff struct {
+	jsonEvent
+	Flipped [][3]int `json:"flipped"`
+}
+
+type jsonFinalTurnComplete struct {
+	jsonEvent
+	Alive [][2]int `json:"alive"`
+	Dying [][2]int `json:"dying"`
+}
+
+type jsonTileStats struct {
+	jsonEvent
+	Computed int `json:"computed"`
+	Skipped  int `json:"skipped"`
+}
+
+type jsonWorker struct {
+	jsonEvent
+	Worker string `json:"worker"`
+}
+
+// jsonCells returns cells as [x,y] pairs, never nil so that an empty list is written as [].
+func jsonCells(cells []util.Cell) [][2]int {
+	pairs := make([][2]int, len(cells))
+	for i, cell := range cells {
+		pairs[i] = [2]int{cell.X, cell.Y}
+	}
+	return pairs
+}
+
+// eventCells returns [x,y] pairs as cells, nil if there are none.
+func eventCells(pairs [][2]int) []util.Cell {
+	var cells []util.Cell
+	for _, pair := range pairs {
+		cells = append(cells, util.Cell{X: pair[0], Y: pair[1]})
+	}
+	return cells
+}
+
+// MarshalEvent returns the JSON object of an event, without a newline.
+func MarshalEvent(event Event) ([]byte, error) {
+	// The type names are those of the Go types, which must not be renamed.
+	header := func(name string) jsonEvent {
+		return jsonEvent{name, event.GetCompletedTurns()}
+	}
+	var v interface{}
+	switch e := event.(type) {
+	case AliveCellsCount:
+		v = jsonAliveCellsCount{header("AliveCellsCount"), e.CellsCount}
+	case ImageOutputComplete:
+		v = jsonImageOutputComplete{header("ImageOutputComplete"), e.Filename}
+	case StateChange:
+		v = jsonStateChange{header("StateChange"), e.NewState.String()}
+	case CellFlipped:
+		v = jsonCellFlipped{header("CellFlipped"), e.Cell.X, e.Cell.Y, e.Value}
+	case TurnDiff:
+		flipped := make([][3]int, len(e.Cells))
+		for i, cell := range e.Cells {
+			flipped[i] = [3]int{cell.X, cell.Y, int(e.Values[i])}
+		}
+		v = jsonTurnDiff{header("TurnDiff"), flipped}
+	case TurnComplete:
+		v = header("TurnComplete")
+	case FinalTurnComplete:
+		v = jsonFinalTurnComplete{header("FinalTurnComplete"), jsonCells(e.Alive), jsonCells(e.Dying)}
+	case TileStats:
+		v = jsonTileStats{header("TileStats"), e.Computed, e.Skipped}
+	case WorkerLost:
+		v = jsonWorker{header("WorkerLost"), e.Worker}
+	case WorkerRecovered:
+		v = jsonWorker{header("WorkerRecovered"), e.Worker}
+	default:
+		return nil, fmt.Errorf("cannot encode the event %T", event)
+	}
+	return json.Marshal(v)
+}
+
+// UnmarshalEvent decodes a JSON object written by MarshalEvent back into its event.
+func UnmarshalEvent(data []byte) (Event, error) {
+	var header jsonEvent
+	if err := json.Unmarshal(data, &header); err != nil {
+		return nil, err
+	}
+	var err error
+	switch header.Type {
+	case "AliveCellsCount":
+		var e jsonAliveCellsCount
+		err = json.Unmarshal(data, &e)
+		return AliveCellsCount{e.Turn, e.Cells}, err
+	case "ImageOutputComplete":
+		var e jsonImageOutputComplete
+		err = json.Unmarshal(data, &e)
+		return ImageOutputComplete{e.Turn, e.Filename}, err
+	case "StateChange":
+		var e jsonStateChange
+		if err = json.Unmarshal(data, &e); err != nil {
+			return nil, err
+		}
+		for state := Paused; state <= Quitting; state++ {
+			if state.String() == e.State {
+				return StateChange{e.Turn, state}, nil
+			}
+		}
+		return nil, fmt.Errorf("unknown state %q", e.State)
+	case "CellFlipped":
+		var e jsonCellFlipped
+		err = json.Unmarshal(data, &e)
+		return CellFlipped{e.Turn, util.Cell{X: e.X, Y: e.Y}, e.Value}, err
+	case "TurnDiff":
+		var e jsonTurnDiff
+		if err = json.Unmarshal(data, &e); err != nil {
+			return nil, err
+		}
+		diff := TurnDiff{CompletedTurns: e.Turn}
+		for _, flipped := range e.Flipped {
+			if flipped[2] < 0 || flipped[2] > 255 {
+				return nil, fmt.Errorf("invalid value %v of a flipped cell", flipped[2])
+			}
+			diff.Cells = append(diff.Cells, util.Cell{X: flipped[0], Y: flipped[1]})
+			diff.Values = append(diff.Values, uint8(flipped[2]))
+		}
+		return diff, nil
+	case "TurnComplete":
+		return TurnComplete{header.Turn}, nil
+	case "FinalTurnComplete":
+		var e jsonFinalTurnComplete
+		err = json.Unmarshal(data, &e)
+		return FinalTurnComplete{e.Turn, eventCells(e.Alive), eventCells(e.Dying)}, err
+	case "TileStats":
+		var e jsonTileStats
+		err = json.Unmarshal(data, &e)
+		return TileStats{e.Turn, e.Computed, e.Skipped}, err
+	case "WorkerLost":
+		var e jsonWorker
+		err = json.Unmarshal(data, &e)
+		return WorkerLost{e.Turn, e.Worker}, err
+	case "WorkerRecovered":
+		var e jsonWorker
+		err = json.Unmarshal(data, &e)
+		return WorkerRecovered{e.Turn, e.Worker}, err
+	}
+	return nil, fmt.Errorf("unknown event type %q", header.Type)
+}
+
+// JSONOptions are the settings of the events written by WriteJSONLines.
+type JSONOptions struct {
+	// Types are the names of the event types written, nil meaning all of them.
+	Types []string
+	// Sample writes one in every Sample flipped cells, whether they are sent as CellFlipped events or in a TurnDiff,
+	// 0 meaning all of them. A TurnDiff left without cells is not written.
+	Sample int
+}
+
+// ParseEventTypes parses a comma separated list of event type names, e.g. AliveCellsCount,TurnComplete.
+func ParseEventTypes(s string) ([]string, error) {
+	var types []string
+	for _, name := range strings.Split(s, ",") {
+		name = strings.TrimSpace(name)
+		known := false
+		for _, t := range EventTypes {
+			known = known || t == name
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown event type %q, expected one of %v", name, strings.Join(EventTypes, ","))
+		}
+		types = append(types, name)
+	}
+	return types, nil
+}
+
+// sampleTurnDiff returns the cells of a TurnDiff kept by writing one in every n flipped cells,
+// counting them in flipped with the CellFlipped events so that both are thinned out alike.
+func sampleTurnDiff(diff TurnDiff, n int, flipped *int) TurnDiff {
+	sampled := TurnDiff{CompletedTurns: diff.CompletedTurns}
+	for i, cell := range diff.Cells {
+		*flipped++
+		if (*flipped-1)%n == 0 {
+			sampled.Cells = append(sampled.Cells, cell)
+			sampled.Values = append(sampled.Values, diff.Values[i])
+		}
+	}
+	return sampled
+}
+
+// WriteJSONLines writes the events of a run to w as JSON Lines, filtered by o.Types and with o.Sample
+// to thin out the flipped cells. The lines are flushed after every event other than CellFlipped,
+// so that a reader following a file or a socket sees every turn as it completes. Every event is forwarded to next,
+// if it is not nil, so that WriteJSONLines can sit between Run and another consumer of the events.
+// next is closed once events is closed. Writing stops at the first error, but the events are still forwarded.
+func WriteJSONLines(w io.Writer, events <-chan Event, next chan<- Event, o JSONOptions) error {
+	if next != nil {
+		defer close(next)
+	}
+	wanted := make(map[string]bool)
+	for _, t := range o.Types {
+		wanted[t] = true
+	}
+	b := bufio.NewWriter(w)
+	var err error
+	flipped := 0
+	for event := range events {
+		if next != nil {
+			next <- event
+		}
+		if err != nil {
+			continue
+		}
+		name := reflect.TypeOf(event).Name()
+		if len(wanted) > 0 && !wanted[name] {
+			continue
+		}
+		_, isFlip := event.(CellFlipped)
+		if isFlip {
+			flipped++
+			if o.Sample > 1 && (flipped-1)%o.Sample != 0 {
+				continue
+			}
+		}
+		if diff, ok := event.(TurnDiff); ok && o.Sample > 1 {
+			if diff = sampleTurnDiff(diff, o.Sample, &flipped); len(diff.Cells) == 0 {
+				continue
+			}
+			event = diff
+		}
+		var line []byte
+		if line, err = MarshalEvent(event); err != nil {
+			continue
+		}
+		b.Write(line)
+		b.WriteByte('\n')
+		if !isFlip {
+			err = b.Flush()
+		}
+	}
+	if err != nil {
+		return err
+	}
+	return b.Flush()
+}
+
+// ReadJSONLines decodes the JSON Lines written by WriteJSONLines and sends their events to events,
+// closing it at the end, so that a stream can be fed back into the viewer or the tests. Blank lines are skipped.
+func ReadJSONLines(r io.Reader, events chan<- Event) error {
+	defer close(events)
+	scanner := bufio.NewScanner(r)
+	// The final turn of a large board lists every alive cell on one line.
+	scanner.Buffer(nil, 1<<30)
+	for line := 1; scanner.Scan(); line++ {
+		if len(strings.TrimSpace(scanner.Text())) == 0 {
+			continue
+		}
+		event, err := UnmarshalEvent(scanner.Bytes())
+		if err != nil {
+			return fmt.Errorf("line %v: %v", line, err)
+		}
+		events <- event
+	}
+	return scanner.Err()
+}
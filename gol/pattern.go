@@ -0,0 +1,284 @@
+package gol
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// Format is the file format of the initial world and of the images written out.
+type Format int
+
+const (
+	// PGM is a binary greyscale image of the board.
+	PGM Format = iota
+	// RLE is Golly's run length encoded pattern format, which records the rule and the topology.
+	RLE
+	// Plaintext is LifeWiki's .cells format, a grid of . and O.
+	Plaintext
+	// Life105 is the Life 1.05 format, blocks of . and * rows, which records the rule.
+	Life105
+	// Life106 is the Life 1.06 format, a list of the coordinates of the alive cells.
+	Life106
+	// PBM is a binary bitmap of the board, eight cells to a byte, which only records the alive cells.
+	PBM
+	// PNG is a paletted image of the board. Jpeg images are read as well.
+	PNG
+)
+
+var formatNames = map[Format]string{
+	PGM:       "pgm",
+	RLE:       "rle",
+	Plaintext: "cells",
+	Life105:   "life105",
+	Life106:   "life106",
+	PBM:       "pbm",
+	PNG:       "png",
+}
+
+func (f Format) String() string {
+	if name, ok := formatNames[f]; ok {
+		return name
+	}
+	return "Incorrect Format"
+}
+
+// ParseFormat returns the format with the given name.
+func ParseFormat(s string) (Format, error) {
+	for f, name := range formatNames {
+		if strings.EqualFold(strings.TrimSpace(s), name) {
+			return f, nil
+		}
+	}
+	return PGM, fmt.Errorf("unknown format %q", s)
+}
+
+// image reports whether a format is an image of the board rather than a pattern.
+func (f Format) image() bool {
+	return f == PGM || f == PBM || f == PNG
+}
+
+// extension returns the file extension of a format.
+func (f Format) extension() string {
+	switch f {
+	case Life105, Life106:
+		return "lif"
+	}
+	return f.String()
+}
+
+// FormatOfPath returns the format of the images written to path from its extension, ignoring a .gz extension.
+// The .lif extension is taken to mean Life 1.06, as it is the format most programs read.
+func FormatOfPath(path string) (Format, error) {
+	switch filepath.Ext(strings.TrimSuffix(strings.ToLower(path), ".gz")) {
+	case ".pgm":
+		return PGM, nil
+	case ".pbm":
+		return PBM, nil
+	case ".png":
+		return PNG, nil
+	case ".rle":
+		return RLE, nil
+	case ".cells":
+		return Plaintext, nil
+	case ".lif", ".life":
+		return Life106, nil
+	}
+	return PGM, fmt.Errorf("cannot tell the format of %v from its extension", path)
+}
+
+// inputFormat returns the format of an input file from the extension of its path, ignoring a .gz extension,
+// or, failing that, from its first line.
+// Life 1.05 and Life 1.06 files share the .lif extension and are told apart by their header.
+func inputFormat(path string, data []byte) (Format, error) {
+	line := strings.TrimSpace(string(data))
+	if i := strings.IndexByte(line, '\n'); i >= 0 {
+		line = strings.TrimSpace(line[:i])
+	}
+	switch {
+	case bytes.HasPrefix(data, []byte(pngSignature)) || bytes.HasPrefix(data, []byte("\xff\xd8\xff")):
+		return PNG, nil
+	case len(line) >= 2 && line[0] == 'P' && strings.ContainsRune("1245", rune(line[1])):
+		return PGM, nil
+	case strings.HasPrefix(line, "#Life 1.05"):
+		return Life105, nil
+	case strings.HasPrefix(line, "#Life 1.06"):
+		return Life106, nil
+	}
+	switch filepath.Ext(strings.TrimSuffix(strings.ToLower(path), ".gz")) {
+	case ".pgm", ".pbm":
+		return PGM, nil
+	case ".png", ".jpg", ".jpeg":
+		return PNG, nil
+	case ".rle":
+		return RLE, nil
+	case ".cells":
+		return Plaintext, nil
+	}
+	switch {
+	case strings.HasPrefix(line, "x") || strings.HasPrefix(line, "#"):
+		return RLE, nil
+	case strings.HasPrefix(line, "!") || strings.Trim(line, ".O") == "":
+		return Plaintext, nil
+	}
+	return PGM, fmt.Errorf("%v: unknown format", path)
+}
+
+// decodeInput decodes an input file in any of the formats. The grey levels of a pbm or pgm image are turned into the states
+// of the rule of p, and the image is positioned if it records an origin. Png and jpeg images are decoded by decodePng.
+func decodeInput(path string, data []byte, p Params) (util.Pattern, error) {
+	format, err := inputFormat(path, data)
+	if err != nil {
+		return util.Pattern{}, err
+	}
+	var pattern util.Pattern
+	switch format {
+	case PGM:
+		var header util.PgmHeader
+		var raster []byte
+		if header, raster, err = util.ParsePgm(data); err != nil {
+			break
+		}
+		pattern = util.Pattern{Width: header.Width, Height: header.Height, Cells: make([]uint8, len(raster)), Origin: header.Origin}
+		pattern.Positioned = header.Origin != image.Point{}
+		for i, value := range raster {
+			pattern.Cells[i] = uint8(p.Rule.state(value))
+		}
+	case PNG:
+		pattern, err = decodePng(data, p)
+	case RLE:
+		pattern, err = util.ReadRle(bytes.NewReader(data))
+	case Plaintext:
+		pattern, err = util.ReadPlaintext(bytes.NewReader(data))
+	case Life105:
+		pattern, err = util.ReadLife105(bytes.NewReader(data))
+	case Life106:
+		pattern, err = util.ReadLife106(bytes.NewReader(data))
+	}
+	if err != nil {
+		return pattern, fmt.Errorf("%v: %v", path, err)
+	}
+	return pattern, nil
+}
+
+// writePatternFile writes a pattern to a file in a pattern format.
+func writePatternFile(w io.Writer, format Format, pattern util.Pattern) error {
+	switch format {
+	case RLE:
+		return util.WriteRle(w, pattern)
+	case Plaintext:
+		return util.WritePlaintext(w, pattern)
+	case Life105:
+		return util.WriteLife105(w, pattern)
+	case Life106:
+		return util.WriteLife106(w, pattern)
+	}
+	return fmt.Errorf("%v is not a pattern format", format)
+}
+
+// ReadInput reads the initial world from the file at p.Input, or from standard input if it is "-", and returns p
+// holding the world, so that the file is read only once however often ReadInput is called on the result.
+// A gzipped file is decompressed. A 0x0 board takes the size of the file, enlarged to hold it at p.InputOffset.
+// The rule recorded in the file replaces that of p, and so does its topology suffix if it has one.
+// Without an input, a bounded board is read from images/<W>x<H>.pgm, which must be the size of the board.
+// It returns an error if the file cannot be read or decoded, or if the world does not fit on a bounded board.
+func ReadInput(p Params) (Params, error) {
+	if p.Resume != "" {
+		return p, nil
+	}
+	if p.Input == "" {
+		return readPgmImage(p)
+	}
+	if p.input == nil {
+		file := os.Stdin
+		if p.Input != "-" {
+			var err error
+			if file, err = os.Open(p.Input); err != nil {
+				return p, err
+			}
+			defer file.Close()
+		}
+		r, err := util.Uncompressed(file)
+		if err != nil {
+			return p, fmt.Errorf("%v: %v", p.Input, err)
+		}
+		data, err := ioutil.ReadAll(r)
+		if err != nil {
+			return p, fmt.Errorf("%v: %v", p.Input, err)
+		}
+		decoding := p
+		decoding.Rule = p.Rule.orDefault()
+		pattern, err := decodeInput(p.Input, data, decoding)
+		if err != nil {
+			return p, err
+		}
+		p.input = &pattern
+	}
+	pattern := *p.input
+	if p.ImageWidth == 0 && p.ImageHeight == 0 {
+		p.ImageWidth, p.ImageHeight = pattern.Width, pattern.Height
+		if p.InputOffset != nil {
+			p.ImageWidth += p.InputOffset.X
+			p.ImageHeight += p.InputOffset.Y
+		}
+	}
+	if pattern.Rule != "" {
+		rule, topology := pattern.Rule, ""
+		if i := strings.Index(rule, ":"); i >= 0 {
+			rule, topology = rule[:i], rule[i+1:]
+		}
+		var err error
+		if p.Rule, err = ParseRule(rule); err != nil {
+			return p, fmt.Errorf("%v: %v", p.Input, err)
+		}
+		if topology != "" {
+			if p.Topology, err = ParseTopology(topology, p.ImageWidth, p.ImageHeight); err != nil {
+				return p, fmt.Errorf("%v: %v", p.Input, err)
+			}
+		}
+	}
+	if r := patternRect(p, pattern); p.Topology != Unbounded && !r.In(image.Rect(0, 0, p.ImageWidth, p.ImageHeight)) {
+		return p, fmt.Errorf("%v: the %vx%v world at %v does not fit on the %vx%v board",
+			p.Input, pattern.Width, pattern.Height, r.Min, p.ImageWidth, p.ImageHeight)
+	}
+	return p, nil
+}
+
+// patternRect returns the cells of the board covered by a pattern. It is placed at p.InputOffset if it is set,
+// at the position recorded in the file if there is one and the pattern lies on the board there, and otherwise
+// in the centre of the board. Patterns shared on LifeWiki are usually positioned around (0,0), so they are centred.
+func patternRect(p Params, pattern util.Pattern) image.Rectangle {
+	r := image.Rect(0, 0, pattern.Width, pattern.Height)
+	if p.InputOffset != nil {
+		return r.Add(*p.InputOffset)
+	}
+	if pattern.Positioned {
+		placed := r.Add(pattern.Origin)
+		if p.Topology == Unbounded || placed.In(image.Rect(0, 0, p.ImageWidth, p.ImageHeight)) {
+			return placed
+		}
+	}
+	return r.Add(image.Pt((p.ImageWidth-pattern.Width)/2, (p.ImageHeight-pattern.Height)/2))
+}
+
+// writePattern writes the cells of region after turn completed turns to a pattern file in the format p.OutputFormat.
+func writePattern(p Params, c distributorChannels, turn int, region image.Rectangle, get func(x, y int) uint8) {
+	fileName := outputName(p, turn)
+	c.ioCommand <- ioOutputPattern
+	c.ioFilename <- fileName
+	c.ioTurn <- turn
+	c.ioRegion <- region
+	for y := region.Min.Y; y < region.Max.Y; y++ {
+		for x := region.Min.X; x < region.Max.X; x++ {
+			c.ioOutput <- get(x, y)
+		}
+	}
+	c.events <- ImageOutputComplete{turn, fileName}
+}
@@ -0,0 +1,379 @@
+package gol
+
+import (
+	"errors"
+	"fmt"
+	"net/rpc"
+	"sync"
+	"time"
+
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// PeerInit gives a peer its strip, the rows Start to Start+len(Rows)-1 of the world, and the addresses of the peers
+// owning the rows above and below it. An address is empty if the strip is on an edge of the world that is not joined.
+type PeerInit struct {
+	Params Params
+	Start  int
+	Rows   [][]uint8
+	Above  string
+	Below  string
+}
+
+// PeerStep asks a peer to compute a turn once it has the halo rows of its neighbours.
+type PeerStep struct {
+	Turn int
+}
+
+// PeerStepResponse is the number of alive cells in the strip of a peer after a turn, and the cells that flipped.
+type PeerStepResponse struct {
+	Alive   int
+	Flipped []CellFlipped
+}
+
+// Halo is an edge row of a peer sent to its neighbour before a turn. Below is true if it is the row below the neighbour's strip.
+type Halo struct {
+	Turn  int
+	Below bool
+	Row   []uint8
+}
+
+// PeerRows holds the strip of a peer.
+type PeerRows struct {
+	Rows [][]uint8
+}
+
+// haloTimeout is how long a peer waits for the halo row of a neighbour before giving up on the turn,
+// so that a peer whose neighbour has died returns an error to the coordinator rather than waiting forever.
+const haloTimeout = 5 * time.Second
+
+// haloKey identifies the halo row received for a turn.
+type haloKey struct {
+	turn  int
+	below bool
+}
+
+// Peer is the net/rpc service of a worker process taking part in a peer-to-peer run. It owns a strip of the world
+// and only exchanges its edge rows, directly with the peers above and below, while the coordinator only synchronises turns.
+type Peer struct {
+	mu           sync.Mutex
+	halosArrived *sync.Cond
+	p            Params
+	start        int
+	rows         [][]uint8
+	above, below *rpc.Client
+	halos        map[haloKey][]uint8
+}
+
+func newPeer() *Peer {
+	peer := new(Peer)
+	peer.halosArrived = sync.NewCond(&peer.mu)
+	return peer
+}
+
+// peerSupports returns an error if a world with the given parameters cannot be split between peers.
+// A peer only knows its own rows and halo rows, so every edge must be either dead or joined to the opposite edge without a twist.
+func peerSupports(p Params) error {
+	switch p.Topology {
+	case Torus, Plane, HorizontalCylinder, VerticalCylinder:
+		return nil
+	}
+	return fmt.Errorf("peers do not support the %v topology", p.Topology)
+}
+
+// Init replaces the strip of the peer and connects to its neighbours.
+func (peer *Peer) Init(req PeerInit, res *struct{}) error {
+	peer.mu.Lock()
+	defer peer.mu.Unlock()
+	peer.closeNeighbours()
+	peer.p = req.Params
+	peer.start = req.Start
+	peer.rows = req.Rows
+	peer.halos = make(map[haloKey][]uint8)
+
+	var err error
+	if req.Above != "" {
+		if peer.above, err = rpc.Dial("tcp", req.Above); err != nil {
+			return err
+		}
+	}
+	if req.Below != "" {
+		if peer.below, err = rpc.Dial("tcp", req.Below); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (peer *Peer) closeNeighbours() {
+	if peer.above != nil {
+		peer.above.Close()
+		peer.above = nil
+	}
+	if peer.below != nil {
+		peer.below.Close()
+		peer.below = nil
+	}
+}
+
+// PutHalo stores a halo row sent by a neighbour.
+func (peer *Peer) PutHalo(halo Halo, res *struct{}) error {
+	peer.mu.Lock()
+	defer peer.mu.Unlock()
+	if peer.halos == nil {
+		return errors.New("the peer has no strip, call Peer.Init first")
+	}
+	peer.halos[haloKey{halo.Turn, halo.Below}] = halo.Row
+	peer.halosArrived.Broadcast()
+	return nil
+}
+
+// Step sends the edge rows of the strip to the neighbours, waits for their edge rows and computes the next turn.
+func (peer *Peer) Step(req PeerStep, res *PeerStepResponse) error {
+	peer.mu.Lock()
+	rows, above, below, start := peer.rows, peer.above, peer.below, peer.start
+	peer.mu.Unlock()
+	if rows == nil {
+		return errors.New("the peer has no strip, call Peer.Init first")
+	}
+
+	// The first row is the halo below the strip of the peer above, and the last row the halo above the strip of the peer below.
+	var calls []*rpc.Call
+	if above != nil {
+		calls = append(calls, above.Go("Peer.PutHalo", Halo{req.Turn, true, rows[0]}, new(struct{}), nil))
+	}
+	if below != nil {
+		calls = append(calls, below.Go("Peer.PutHalo", Halo{req.Turn, false, rows[len(rows)-1]}, new(struct{}), nil))
+	}
+	for _, call := range calls {
+		if (<-call.Done).Error != nil {
+			return call.Error
+		}
+	}
+
+	width := len(rows[0])
+	dead := make([]uint8, width)
+	peer.mu.Lock()
+	haloAbove, haloBelow := dead, dead
+	var err error
+	if above != nil {
+		haloAbove, err = peer.waitForHalo(haloKey{req.Turn, false})
+	}
+	if below != nil && err == nil {
+		haloBelow, err = peer.waitForHalo(haloKey{req.Turn, true})
+	}
+	peer.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	wrapsX, _ := straightWrap(peer.p.Topology)
+	strip := make([][]uint8, len(rows)+2)
+	for i := range strip {
+		row := haloAbove
+		if i == len(strip)-1 {
+			row = haloBelow
+		} else if i > 0 {
+			row = rows[i-1]
+		}
+		strip[i] = make([]uint8, width+2)
+		copy(strip[i][1:], row)
+		if wrapsX {
+			strip[i][0], strip[i][width+1] = row[width-1], row[0]
+		}
+	}
+
+	newRows := make([][]uint8, len(rows))
+	for i := range newRows {
+		newRows[i] = make([]uint8, width)
+		for x := range newRows[i] {
+			value := strip[i+1][x+1]
+			newRows[i][x] = peer.p.Rule.next(value, calculateNeighbours(i+1, x+1, strip))
+			if newRows[i][x] == alive {
+				res.Alive++
+			}
+			if newRows[i][x] != value {
+				res.Flipped = append(res.Flipped, CellFlipped{
+					CompletedTurns: req.Turn,
+					Cell:           util.Cell{X: x, Y: start + i},
+					Value:          newRows[i][x],
+				})
+			}
+		}
+	}
+
+	peer.mu.Lock()
+	peer.rows = newRows
+	peer.mu.Unlock()
+	return nil
+}
+
+// waitForHalo waits until the halo row is received and removes it, or returns an error after haloTimeout.
+// The peer must be locked.
+func (peer *Peer) waitForHalo(key haloKey) ([]uint8, error) {
+	deadline := time.Now().Add(haloTimeout)
+	// The waits are woken up at the deadline, as a sync.Cond cannot time out.
+	timer := time.AfterFunc(haloTimeout, func() {
+		peer.mu.Lock()
+		defer peer.mu.Unlock()
+		peer.halosArrived.Broadcast()
+	})
+	defer timer.Stop()
+	for peer.halos[key] == nil {
+		if !time.Now().Before(deadline) {
+			side := "above"
+			if key.below {
+				side = "below"
+			}
+			return nil, fmt.Errorf("no halo row from the peer %v for turn %v within %v", side, key.turn, haloTimeout)
+		}
+		peer.halosArrived.Wait()
+	}
+	row := peer.halos[key]
+	delete(peer.halos, key)
+	return row, nil
+}
+
+// Rows returns the strip of the peer.
+func (peer *Peer) Rows(req struct{}, res *PeerRows) error {
+	peer.mu.Lock()
+	defer peer.mu.Unlock()
+	res.Rows = peer.rows
+	return nil
+}
+
+// calculateWorldPeers executes all turns on the peers at p.Peers, one strip of rows each.
+// The coordinator only waits for every peer to finish each turn, sums their alive cells and sends the cells they flipped.
+// The world is collected from the peers for snapshots and the FinalTurnComplete event.
+// If a peer cannot be reached or fails a turn, the run ends with a RunFailed event.
+func calculateWorldPeers(p Params, c distributorChannels, world [][]uint8, start int) {
+	height := len(world)
+	peers := len(p.Peers)
+	if peers > height {
+		peers = height
+	}
+	clients := make([]*rpc.Client, peers)
+	for i := range clients {
+		client, err := rpc.Dial("tcp", p.Peers[i])
+		if err != nil {
+			failRun(c, start, err, nil)
+			return
+		}
+		defer client.Close()
+		clients[i] = client
+	}
+
+	_, wrapsY := straightWrap(p.Topology)
+	var calls []*rpc.Call
+	for i, client := range clients {
+		req := PeerInit{
+			Params: p,
+			Start:  i * height / peers,
+			Rows:   world[i*height/peers : (i+1)*height/peers],
+		}
+		if i > 0 || wrapsY {
+			req.Above = p.Peers[(i+peers-1)%peers]
+		}
+		if i < peers-1 || wrapsY {
+			req.Below = p.Peers[(i+1)%peers]
+		}
+		calls = append(calls, client.Go("Peer.Init", req, new(struct{}), nil))
+	}
+	for _, call := range calls {
+		if err := (<-call.Done).Error; err != nil {
+			failRun(c, start, err, nil)
+			return
+		}
+	}
+
+	collect := func() error {
+		for i, client := range clients {
+			var res PeerRows
+			if err := client.Call("Peer.Rows", struct{}{}, &res); err != nil {
+				return err
+			}
+			copy(world[i*height/peers:], res.Rows)
+		}
+		return nil
+	}
+
+	ticker := createTicker(2 * time.Second)
+	done := make(chan bool)
+	var turn int
+	numberAlive := len(getCurrentAliveCells(world))
+
+	tickerRun(c, &turn, &numberAlive, done, ticker)
+
+	checkpoints := newCheckpointer(p, start)
+	// lost is the error of a peer that could not be collected from, which ends the run.
+	var lost error
+	save := func() {
+		if lost = collect(); lost != nil {
+			fmt.Println("The world could not be collected from the peers:", lost)
+			return
+		}
+		writePgm(p, c, turn, world)
+		writeWorldCheckpoint(p, c, turn, world)
+	}
+	for turn = start; turn < p.Turns; turn++ {
+
+		if manageSdlInput(p, c, &turn, save, done, ticker, &numberAlive) {
+			return
+		}
+		if lost == nil && checkpoints.due(turn) {
+			if lost = collect(); lost == nil {
+				writeWorldCheckpoint(p, c, turn, world)
+			}
+		}
+		if lost != nil {
+			ticker.stopTicker(done)
+			failRun(c, turn, lost, nil)
+			return
+		}
+
+		// The turn barrier: the next turn is not started before every peer has finished this one.
+		calls = calls[:0]
+		for _, client := range clients {
+			calls = append(calls, client.Go("Peer.Step", PeerStep{turn}, new(PeerStepResponse), nil))
+		}
+		numberAliveThisTurn := 0
+		var diff flips
+		for _, call := range calls {
+			if err := (<-call.Done).Error; err != nil {
+				lost = err
+				continue
+			}
+			res := call.Reply.(*PeerStepResponse)
+			numberAliveThisTurn += res.Alive
+			for _, flipped := range res.Flipped {
+				diff.add(flipped.Cell.X, flipped.Cell.Y, flipped.Value)
+			}
+		}
+		if lost != nil {
+			ticker.stopTicker(done)
+			failRun(c, turn, lost, nil)
+			return
+		}
+		diff.send(p, c, turn)
+
+		c.events <- TurnComplete{
+			CompletedTurns: turn,
+		}
+		numberAlive = numberAliveThisTurn
+	}
+
+	if lost = collect(); lost != nil {
+		ticker.stopTicker(done)
+		failRun(c, p.Turns, lost, nil)
+		return
+	}
+	writePgm(p, c, p.Turns, world)
+
+	c.events <- FinalTurnComplete{
+		CompletedTurns: p.Turns,
+		Alive:          getCurrentAliveCells(world),
+		Dying:          getCurrentDyingCells(world),
+	}
+
+	closeProgramm(c, p.Turns, done, ticker)
+}
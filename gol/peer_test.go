@@ -0,0 +1,42 @@
+package gol
+
+import (
+	"net"
+	"net/rpc"
+	"testing"
+	"time"
+)
+
+// TestPeerHaloTimeout steps a peer whose neighbour never steps, and so never sends its halo row,
+// and checks that the step returns an error after haloTimeout instead of waiting forever.
+func TestPeerHaloTimeout(t *testing.T) {
+	p := Params{ImageWidth: 4, ImageHeight: 4, Rule: Conway}
+	neighbour := newPeer()
+	server := rpc.NewServer()
+	if err := server.Register(neighbour); err != nil {
+		t.Fatal(err)
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go server.Accept(l)
+	if err := neighbour.Init(PeerInit{Params: p, Rows: make([][]uint8, 2)}, new(struct{})); err != nil {
+		t.Fatal(err)
+	}
+
+	peer := newPeer()
+	rows := [][]uint8{make([]uint8, 4), make([]uint8, 4)}
+	if err := peer.Init(PeerInit{Params: p, Start: 2, Rows: rows, Above: l.Addr().String()}, new(struct{})); err != nil {
+		t.Fatal(err)
+	}
+	defer peer.closeNeighbours()
+	started := time.Now()
+	if err := peer.Step(PeerStep{0}, new(PeerStepResponse)); err == nil {
+		t.Fatal("Expected an error without the halo row of the neighbour")
+	}
+	if waited := time.Since(started); waited < haloTimeout {
+		t.Fatalf("Expected the peer to wait %v for the halo row, it gave up after %v", haloTimeout, waited)
+	}
+}
@@ -0,0 +1,105 @@
+package gol
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/jpeg" // jpeg images are decoded by image.Decode
+	"image/png"
+	"io"
+
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// defaultThreshold is the luminance from which the pixels of a png or jpeg image are alive if p.Threshold is 0.
+const defaultThreshold = 128
+
+// statePalette returns the colours of the states of p: p.Palette if it is set, or else the grey levels of the pgm images.
+func statePalette(p Params) color.Palette {
+	if p.Palette != nil {
+		return p.Palette
+	}
+	rule := p.Rule.orDefault()
+	var palette color.Palette
+	for state := 0; state < rule.stateCount(); state++ {
+		palette = append(palette, color.Gray{Y: rule.value(state)})
+	}
+	return palette
+}
+
+// decodePng decodes a png or jpeg image into a pattern. With p.Palette, every pixel takes the state of the colour
+// it matches exactly, and a pixel matching none of them, or a colour beyond the states of the rule, is an error.
+// Otherwise pixels with a luminance of at least p.Threshold are alive and the others dead,
+// so a light drawing on a dark background is read as it is shown.
+// The size of the image is checked before its pixels are decoded, like that of a pgm image.
+func decodePng(data []byte, p Params) (util.Pattern, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return util.Pattern{}, err
+	}
+	if err := util.CheckPatternSize(config.Width, config.Height); err != nil {
+		return util.Pattern{}, err
+	}
+	m, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return util.Pattern{}, err
+	}
+	states := p.Rule.orDefault().stateCount()
+	bounds := m.Bounds()
+	pattern := util.Pattern{Width: bounds.Dx(), Height: bounds.Dy(), Cells: make([]uint8, bounds.Dx()*bounds.Dy())}
+	threshold := p.Threshold
+	if threshold == 0 {
+		threshold = defaultThreshold
+	}
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := m.At(x, y)
+			state := -1
+			if p.Palette == nil {
+				state = 0
+				if color.GrayModel.Convert(c).(color.Gray).Y >= threshold {
+					state = 1
+				}
+			} else {
+				r, g, b, a := c.RGBA()
+				for i, colour := range p.Palette {
+					if pr, pg, pb, pa := colour.RGBA(); pr == r && pg == g && pb == b && pa == a {
+						state = i
+						break
+					}
+				}
+			}
+			if state < 0 {
+				return pattern, fmt.Errorf("the colour %v of pixel (%v,%v) is not in the palette", c, x, y)
+			}
+			if state >= states {
+				return pattern, fmt.Errorf("the colour %v of pixel (%v,%v) is state %v, but %v has %v states", c, x, y, state, p.Rule.orDefault(), states)
+			}
+			pattern.Cells[(y-bounds.Min.Y)*pattern.Width+x-bounds.Min.X] = uint8(state)
+		}
+	}
+	return pattern, nil
+}
+
+// writePng writes the grey levels of a width x height image as a paletted png, in the colours of statePalette
+// and with every cell p.Scale pixels wide and high. States without a colour take the last one.
+func writePng(w io.Writer, p Params, width, height int, pixels []byte) error {
+	scale := p.Scale
+	if scale < 1 {
+		scale = 1
+	}
+	rule := p.Rule.orDefault()
+	palette := statePalette(p)
+	m := image.NewPaletted(image.Rect(0, 0, width*scale, height*scale), palette)
+	for y := 0; y < m.Rect.Dy(); y++ {
+		for x := 0; x < m.Rect.Dx(); x++ {
+			state := rule.state(pixels[y/scale*width+x/scale])
+			if state >= len(palette) {
+				state = len(palette) - 1
+			}
+			m.Pix[y*m.Stride+x] = uint8(state)
+		}
+	}
+	return png.Encode(w, m)
+}
@@ -0,0 +1,353 @@
+package gol
+
+import (
+	"fmt"
+	"image"
+	"strings"
+)
+
+// Decomposition selects how the Cells engine splits a bounded world between the worker threads.
+type Decomposition int
+
+const (
+	// AutoDecomposition picks the grid of workers with the smallest halos for the shape of the board,
+	// preferring more rows of workers on a tie, so that a square board is split into strips by 2 threads and into 4x2 by 8.
+	AutoDecomposition Decomposition = iota
+	// Strips gives every worker a strip of whole rows.
+	Strips
+	// Grid arranges the workers in a grid of rows and columns, with at least two columns if the thread count allows it.
+	Grid
+)
+
+var decompositionNames = map[Decomposition]string{
+	AutoDecomposition: "auto",
+	Strips:            "strips",
+	Grid:              "grid",
+}
+
+func (d Decomposition) String() string {
+	if name, ok := decompositionNames[d]; ok {
+		return name
+	}
+	return "Incorrect Decomposition"
+}
+
+// ParseDecomposition returns the decomposition with the given name.
+func ParseDecomposition(s string) (Decomposition, error) {
+	for d, name := range decompositionNames {
+		if strings.EqualFold(strings.TrimSpace(s), name) {
+			return d, nil
+		}
+	}
+	return AutoDecomposition, fmt.Errorf("unknown decomposition %q", s)
+}
+
+// workerGrid returns the number of rows and columns of workers for a bounded world. Every worker needs at least one cell,
+// so if p.Threads cannot be arranged on the board the largest thread count below it that can is used.
+// Among the arrangements, the one whose largest worker has the shortest perimeter, and so the smallest halo, is picked,
+// and of those the one with the most rows, whose halos are whole rows of the world rather than columns.
+func workerGrid(p Params) (rows, columns int) {
+	for threads := p.Threads; threads > 1; threads-- {
+		best := -1
+		for r := 1; r <= threads; r++ {
+			c := threads / r
+			if r*c != threads || r > p.ImageHeight || c > p.ImageWidth {
+				continue
+			}
+			if p.Decomposition == Strips && c != 1 {
+				continue
+			}
+			cost := (p.ImageWidth+c-1)/c + (p.ImageHeight+r-1)/r
+			// A grid only falls back to strips if there is no other arrangement.
+			if p.Decomposition == Grid && c == 1 {
+				cost += p.ImageWidth + p.ImageHeight
+			}
+			if best < 0 || cost <= best {
+				best, rows, columns = cost, r, c
+			}
+		}
+		if best >= 0 {
+			return rows, columns
+		}
+	}
+	return 1, 1
+}
+
+// worker is a long-lived goroutine that owns a rectangle of the world in two buffers, the current generation
+// and the next one, each with a border of one cell all round for its halo.
+// Before each turn it sends the cells of its rectangle that lie in the halos of other workers over a dedicated channel
+// to each of them, and fills its own halo from the cells they send, so it never reads the buffers of another worker
+// for its own tiles. Halos beyond the edges of the world are mapped through the topology to the workers owning those cells,
+// and cells off a dead edge stay dead.
+// The active tiles of its rectangle are assigned to its queue every turn. Once the queue is empty, the worker
+// steals active tiles from the queues of the others whose halos have arrived, computing them in the buffers of their owner,
+// so that a worker whose region has settled does not sit idle.
+type worker struct {
+	routineNumber int
+	bounds        image.Rectangle
+	p             Params
+	c             distributorChannels
+	tiles         *activeTiles
+
+	// cur and next are the current and next generations of the rectangle and its halo, indexed [y][x]
+	// from the cell above and to the left of its top left cell. The distributor swaps them after every turn.
+	cur, next [][]uint8
+	// sends and receives carry the halo cells to and from the other workers.
+	sends, receives []*haloLink
+
+	// queue holds the active tiles of the rectangle still to be computed in this turn, and pool every worker,
+	// whose queues are stolen from.
+	queue *tileQueue
+	pool  []*worker
+
+	turns    chan int
+	finished chan<- int
+	// results and alive are the changed tiles and the change in alive cells of the last turn,
+	// and flipped its changed cells, which the distributor sends once every worker has finished the turn.
+	results []tileResult
+	alive   int
+	flipped flips
+}
+
+// haloLink carries, every turn, the cells of one worker's rectangle that lie in the halo of another worker.
+// from holds their positions in the buffers of the sender and to those in the buffers of the receiver.
+// The channel holds one message, so that every worker can send all of its halos before receiving, even to itself.
+// The sender fills cells again only in the next turn, by which time the receiver has copied them.
+type haloLink struct {
+	c        chan []uint8
+	from, to []image.Point
+	cells    []uint8
+}
+
+// straightWrap reports whether the topology joins the left and right, and the top and bottom, edges of the world without a twist.
+func straightWrap(t Topology) (x, y bool) {
+	x = t == Torus || t == HorizontalCylinder || t == KleinBottle
+	y = t == Torus || t == VerticalCylinder || t == KleinBottleTwistedSides
+	return x, y
+}
+
+// newWorkerPool starts a grid of workers over a copy of the world, which p.Threads must fit as returned by workerGrid.
+// The rows and columns are split as evenly as possible, so the rectangles differ by at most one cell in each dimension.
+// The workers wait for a turn on their turns channel, which is sent once assignTiles has filled their queues,
+// and send their routine number on finished once it is computed. Closing the turns channels stops them.
+func newWorkerPool(p Params, c distributorChannels, tiles *activeTiles, world [][]uint8, finished chan<- int) []*worker {
+	height, width := len(world), len(world[0])
+	rows, columns := workerGrid(p)
+
+	workers := make([]*worker, rows*columns)
+	for i := range workers {
+		r, col := i/columns, i%columns
+		bounds := image.Rect(col*width/columns, r*height/rows, (col+1)*width/columns, (r+1)*height/rows)
+		w := &worker{
+			routineNumber: i,
+			bounds:        bounds,
+			p:             p,
+			c:             c,
+			tiles:         tiles,
+			cur:           make([][]uint8, bounds.Dy()+2),
+			next:          make([][]uint8, bounds.Dy()+2),
+			turns:         make(chan int),
+			finished:      finished,
+			pool:          workers,
+		}
+		for y := range w.cur {
+			w.cur[y] = make([]uint8, bounds.Dx()+2)
+			w.next[y] = make([]uint8, bounds.Dx()+2)
+		}
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			copy(w.cur[y-bounds.Min.Y+1][1:], world[y][bounds.Min.X:bounds.Max.X])
+		}
+		tileColumns := (bounds.Max.X-1)/activeTileSize - bounds.Min.X/activeTileSize + 1
+		tileRows := (bounds.Max.Y-1)/activeTileSize - bounds.Min.Y/activeTileSize + 1
+		// A worker may compute every tile of the world by stealing them.
+		w.results = make([]tileResult, 0, len(tiles.active)*len(tiles.active[0]))
+		w.queue = &tileQueue{tiles: make([]queuedTile, 0, tileColumns*tileRows)}
+		workers[i] = w
+	}
+
+	// Every cell of every halo is mapped through the topology to the worker whose rectangle holds it.
+	links := make(map[[2]int]*haloLink)
+	for _, w := range workers {
+		b := w.bounds
+		for y := b.Min.Y - 1; y <= b.Max.Y; y++ {
+			for x := b.Min.X - 1; x <= b.Max.X; x++ {
+				if image.Pt(x, y).In(b) {
+					continue
+				}
+				wx, wy, ok := p.Topology.wrap(x, y, width, height)
+				if !ok {
+					continue
+				}
+				owner := workerAt(workers, wx, wy)
+				link := links[[2]int{owner.routineNumber, w.routineNumber}]
+				if link == nil {
+					link = &haloLink{c: make(chan []uint8, 1)}
+					links[[2]int{owner.routineNumber, w.routineNumber}] = link
+					owner.sends = append(owner.sends, link)
+					w.receives = append(w.receives, link)
+				}
+				link.from = append(link.from, owner.local(wx, wy))
+				link.to = append(link.to, w.local(x, y))
+			}
+		}
+	}
+	for _, link := range links {
+		link.cells = make([]uint8, len(link.from))
+	}
+
+	for _, w := range workers {
+		go w.run()
+	}
+	return workers
+}
+
+// workerAt returns the worker whose rectangle holds the cell (x, y) of the world.
+func workerAt(workers []*worker, x, y int) *worker {
+	for _, w := range workers {
+		if image.Pt(x, y).In(w.bounds) {
+			return w
+		}
+	}
+	panic("no worker holds the cell")
+}
+
+// local returns the position of the cell (x, y) of the world in the buffers of the worker.
+func (w *worker) local(x, y int) image.Point {
+	return image.Pt(x-w.bounds.Min.X+1, y-w.bounds.Min.Y+1)
+}
+
+func (w *worker) run() {
+	for range w.turns {
+		select {
+		case value1 := <-w.c.stopResume[w.routineNumber]:
+			fmt.Println("Goroutine [", w.routineNumber, "] has stopped. Its value is: ", value1)
+			value2 := <-w.c.stopResume[w.routineNumber]
+			fmt.Println("Goroutine [", w.routineNumber, "] has resumed. Its value is: ", value2)
+		default:
+		}
+
+		w.exchangeHalos()
+		w.queue.open()
+		w.calculateNextRectangle()
+		w.finished <- w.routineNumber
+	}
+}
+
+// exchangeHalos sends the cells of the rectangle in the halos of the other workers and fills the halo from the cells they send.
+func (w *worker) exchangeHalos() {
+	for _, link := range w.sends {
+		for i, point := range link.from {
+			link.cells[i] = w.cur[point.Y][point.X]
+		}
+		link.c <- link.cells
+	}
+	for _, link := range w.receives {
+		cells := <-link.c
+		for i, point := range link.to {
+			w.cur[point.Y][point.X] = cells[i]
+		}
+	}
+}
+
+// gatherWorld copies the current generation of every worker into world. The workers must be waiting for a turn.
+func gatherWorld(workers []*worker, world [][]uint8) {
+	for _, w := range workers {
+		b := w.bounds
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			copy(world[y][b.Min.X:b.Max.X], w.cur[y-b.Min.Y+1][1:b.Dx()+1])
+		}
+	}
+}
+
+// assignTiles assigns the active tiles of this turn to the queues of the workers whose rectangles hold them.
+func assignTiles(workers []*worker, tiles *activeTiles) {
+	for _, w := range workers {
+		w.queue.assign(tiles, w.bounds)
+	}
+}
+
+// runTurn computes a turn with the worker pool. Once every worker has finished it, their buffers are swapped,
+// the cells they flipped are merged into diff, the tiles they changed are marked active for the next turn,
+// and the change in alive cells is returned.
+func runTurn(workers []*worker, tiles *activeTiles, finished <-chan int, turn int, diff *flips) int {
+	assignTiles(workers, tiles)
+	for _, w := range workers {
+		w.turns <- turn
+	}
+	// The turn barrier: no worker starts the next turn before every worker has finished this one.
+	// A worker may still be computing a tile stolen from another once that one has finished,
+	// so the buffers are only swapped here.
+	for range workers {
+		<-finished
+	}
+
+	alive := 0
+	for _, w := range workers {
+		w.cur, w.next = w.next, w.cur
+		diff.merge(&w.flipped)
+		for _, result := range w.results {
+			tiles.mark(result.key, result.changed)
+		}
+		alive += w.alive
+	}
+	tiles.advance()
+	return alive
+}
+
+// calculateNextRectangle copies the inactive tiles of the rectangle into the next generation and computes its active tiles,
+// then steals active tiles from the other workers until every queue is empty.
+func (w *worker) calculateNextRectangle() {
+	w.results = w.results[:0]
+	w.alive = 0
+	b := w.bounds
+	for ty := b.Min.Y / activeTileSize; ty <= (b.Max.Y-1)/activeTileSize; ty++ {
+		for tx := b.Min.X / activeTileSize; tx <= (b.Max.X-1)/activeTileSize; tx++ {
+			if !w.tiles.active[tx][ty] {
+				r := w.tiles.rect(tileKey{tx, ty}).Intersect(b)
+				min, max := w.local(r.Min.X, r.Min.Y), w.local(r.Max.X, r.Max.Y)
+				for y := min.Y; y < max.Y; y++ {
+					copy(w.next[y][min.X:max.X], w.cur[y][min.X:max.X])
+				}
+			}
+		}
+	}
+
+	for {
+		owner := w
+		tile, ok := w.queue.pop()
+		for i := 1; !ok && i < len(w.pool); i++ {
+			owner = w.pool[(w.routineNumber+i)%len(w.pool)]
+			tile, ok = owner.queue.steal()
+		}
+		if !ok {
+			return
+		}
+		if changed := w.calculateNextTile(owner, tile.r); !changed.Empty() {
+			w.results = append(w.results, tileResult{tile.key, changed})
+		}
+	}
+}
+
+// calculateNextTile computes the cells of a tile, or the part of it in the rectangle of its owner, in the buffers of the owner,
+// which is another worker if the tile was stolen, and returns the rectangle of changed cells.
+func (w *worker) calculateNextTile(owner *worker, r image.Rectangle) image.Rectangle {
+	var changed image.Rectangle
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			l := owner.local(x, y)
+			value := owner.cur[l.Y][l.X]
+			newValue := w.p.Rule.next(value, calculateNeighbours(l.Y, l.X, owner.cur))
+			owner.next[l.Y][l.X] = newValue
+			if newValue != value {
+				changed = changed.Union(image.Rect(x, y, x+1, y+1))
+				if value == alive {
+					w.alive--
+				} else if newValue == alive {
+					w.alive++
+				}
+				w.flipped.add(x, y, newValue)
+			}
+		}
+	}
+	return changed
+}
@@ -0,0 +1,165 @@
+package gol
+
+import (
+	"fmt"
+	"testing"
+
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// newImagePool starts a worker pool over the 512x512 image, which keeps changing for thousands of turns.
+func newImagePool(threads int) ([]*worker, *activeTiles, chan int) {
+	p := Params{Threads: threads, ImageWidth: 512, ImageHeight: 512, Rule: Conway}
+	world := make([][]uint8, p.ImageHeight)
+	for y := range world {
+		world[y] = make([]uint8, p.ImageWidth)
+	}
+	for _, cell := range util.ReadAliveCells("../images/512x512.pgm", 512, 512) {
+		world[cell.Y][cell.X] = alive
+	}
+	c := distributorChannels{events: make(chan Event), stopResume: make([]chan bool, threads)}
+	tiles := newActiveTiles(p.ImageWidth, p.ImageHeight, p.Topology)
+	finished := make(chan int)
+	return newWorkerPool(p, c, tiles, world, finished), tiles, finished
+}
+
+// BenchmarkWorkerPoolTurn measures the turns of the worker pool on the 512x512 image, up to the sending of the flipped cells.
+// The buffers of the TurnDiff events sent by the distributor are measured with the rest of its loop by BenchmarkDistributorTurn.
+func BenchmarkWorkerPoolTurn(b *testing.B) {
+	for _, threads := range []int{1, 4, 16} {
+		b.Run(fmt.Sprintf("512x512-%v", threads), func(b *testing.B) {
+			workers, tiles, finished := newImagePool(threads)
+			defer func() {
+				for _, w := range workers {
+					close(w.turns)
+				}
+			}()
+			var diff flips
+			b.ReportAllocs()
+			b.ResetTimer()
+			for turn := 0; turn < b.N; turn++ {
+				runTurn(workers, tiles, finished, turn, &diff)
+				diff.cells, diff.values = diff.cells[:0], diff.values[:0]
+			}
+		})
+	}
+}
+
+// TestWorkerPoolTurnAllocs checks that, once its buffers have grown, a turn of the worker pool on a changing board does not allocate.
+// The distributor still allocates the cells of the TurnDiff it sends after every turn.
+func TestWorkerPoolTurnAllocs(t *testing.T) {
+	for _, threads := range []int{1, 4, 16} {
+		workers, tiles, finished := newImagePool(threads)
+		turn := 0
+		var diff flips
+		step := func() {
+			if n := runTurn(workers, tiles, finished, turn, &diff); n == 0 && len(diff.cells) == 0 {
+				t.Fatalf("Expected the board to change in turn %v", turn)
+			}
+			diff.cells, diff.values = diff.cells[:0], diff.values[:0]
+			turn++
+		}
+		for turn < 50 {
+			step()
+		}
+		if allocs := testing.AllocsPerRun(100, step); allocs != 0 {
+			t.Errorf("Expected no allocations in a turn with %v threads, got %v", threads, allocs)
+		}
+		for _, w := range workers {
+			close(w.turns)
+		}
+	}
+}
+
+// TestWorkStealing has the second of two workers compute its own tiles of the 64x64 image and then steal every tile
+// of the first, and checks the result against the board after one turn.
+func TestWorkStealing(t *testing.T) {
+	p := Params{Threads: 2, ImageWidth: 64, ImageHeight: 64, Rule: Conway, Decomposition: Strips}
+	world := make([][]uint8, p.ImageHeight)
+	for y := range world {
+		world[y] = make([]uint8, p.ImageWidth)
+	}
+	for _, cell := range util.ReadAliveCells("../images/64x64.pgm", 64, 64) {
+		world[cell.Y][cell.X] = alive
+	}
+	c := distributorChannels{events: make(chan Event), stopResume: make([]chan bool, p.Threads)}
+	tiles := newActiveTiles(p.ImageWidth, p.ImageHeight, p.Topology)
+	workers := newWorkerPool(p, c, tiles, world, make(chan int))
+	defer func() {
+		for _, w := range workers {
+			close(w.turns)
+		}
+	}()
+
+	assignTiles(workers, tiles)
+	exchanged := make(chan bool)
+	go func() {
+		workers[0].exchangeHalos()
+		exchanged <- true
+	}()
+	workers[1].exchangeHalos()
+	<-exchanged
+	workers[1].queue.open()
+	if _, ok := workers[0].queue.steal(); ok {
+		t.Fatal("Expected no tile to be stolen before the halo of its worker has arrived")
+	}
+	workers[0].queue.open()
+	workers[1].calculateNextRectangle()
+
+	if _, ok := workers[0].queue.pop(); ok {
+		t.Fatal("Expected every tile of the first worker to be stolen")
+	}
+	for _, w := range workers {
+		w.cur, w.next = w.next, w.cur
+	}
+	gatherWorld(workers, world)
+	var cells []util.Cell
+	for y := range world {
+		for x := range world[y] {
+			if world[y][x] == alive {
+				cells = append(cells, util.Cell{X: x, Y: y})
+			}
+		}
+	}
+	expected := util.ReadAliveCells("../check/images/64x64x1.pgm", 64, 64)
+	if len(cells) != len(expected) || workers[1].alive != len(expected)-len(util.ReadAliveCells("../images/64x64.pgm", 64, 64)) {
+		t.Fatalf("Expected %v alive cells after stealing every tile, got %v", len(expected), len(cells))
+	}
+	alive := make(map[util.Cell]bool)
+	for _, cell := range cells {
+		alive[cell] = true
+	}
+	for _, cell := range expected {
+		if !alive[cell] {
+			t.Fatalf("Expected %v to be alive", cell)
+		}
+	}
+}
+
+// TestWorkerGrid checks the arrangements of workers picked for square and non-square boards.
+func TestWorkerGrid(t *testing.T) {
+	tests := []struct {
+		width, height, threads int
+		decomposition          Decomposition
+		rows, columns          int
+	}{
+		{512, 512, 1, AutoDecomposition, 1, 1},
+		{512, 512, 2, AutoDecomposition, 2, 1},
+		{512, 512, 4, AutoDecomposition, 2, 2},
+		{512, 512, 8, AutoDecomposition, 4, 2},
+		{512, 512, 16, AutoDecomposition, 4, 4},
+		{64, 64, 6, AutoDecomposition, 3, 2},
+		{512, 512, 8, Strips, 8, 1},
+		{512, 512, 2, Grid, 1, 2},
+		{512, 512, 8, Grid, 4, 2},
+		{2048, 24, 4, AutoDecomposition, 1, 4},
+		{16, 16, 48, Strips, 16, 1},
+	}
+	for _, test := range tests {
+		p := Params{ImageWidth: test.width, ImageHeight: test.height, Threads: test.threads, Decomposition: test.decomposition}
+		if rows, columns := workerGrid(p); rows != test.rows || columns != test.columns {
+			t.Errorf("Expected %v threads on %vx%v with %v to be %vx%v, got %vx%v",
+				test.threads, test.width, test.height, test.decomposition, test.rows, test.columns, rows, columns)
+		}
+	}
+}
@@ -0,0 +1,262 @@
+package gol
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// Animation is the file format of the animations written by Record.
+type Animation int
+
+const (
+	// GIF is an animated GIF.
+	GIF Animation = iota
+	// APNG is an animated PNG, which viewers without APNG support show as its first frame.
+	APNG
+)
+
+// AnimationOfPath returns the format of an animation from the extension of its path, .gif, .png or .apng.
+func AnimationOfPath(path string) (Animation, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".gif":
+		return GIF, nil
+	case ".png", ".apng":
+		return APNG, nil
+	}
+	return GIF, fmt.Errorf("cannot tell the animation format of %v from its extension", path)
+}
+
+// RecordOptions are the settings of the animation written by Record.
+type RecordOptions struct {
+	Format Animation
+	// Stride is the number of turns between frames, 0 meaning every turn.
+	Stride int
+	// Scale is the width and height in pixels of every cell, 0 meaning 1.
+	Scale int
+	// Palette holds the colour of every state: dead, alive and then the dying states of Generations rules.
+	// States without a colour take the last one. If it is nil, the states are drawn in the colours of the png images.
+	Palette color.Palette
+	// MaxFrames is the largest number of frames recorded, 0 meaning no limit.
+	// The events of the turns after the last frame are still forwarded.
+	MaxFrames int
+	// Delay is the time each frame is shown for, 0 meaning 100ms.
+	Delay time.Duration
+}
+
+// ParsePalette parses a comma separated list of colours in hex notation, e.g. #000000,#ffffff.
+func ParsePalette(s string) (color.Palette, error) {
+	var palette color.Palette
+	for _, field := range strings.Split(s, ",") {
+		field = strings.TrimPrefix(strings.TrimSpace(field), "#")
+		rgb, err := strconv.ParseUint(field, 16, 32)
+		if err != nil || len(field) != 6 {
+			return nil, fmt.Errorf("invalid colour %q", field)
+		}
+		palette = append(palette, color.RGBA{R: uint8(rgb >> 16), G: uint8(rgb >> 8), B: uint8(rgb), A: 255})
+	}
+	if len(palette) < 2 {
+		return nil, errors.New("a palette needs colours for at least the dead and alive states")
+	}
+	return palette, nil
+}
+
+// Record writes an animation of the board of the run p to w, drawn from the CellFlipped, TurnDiff and TurnComplete events,
+// with a frame after every o.Stride turns. Every event is forwarded to next, if it is not nil, so that Record can sit
+// between Run and another consumer of the events such as the viewer. next is closed and the animation written
+// once events is closed. The cells of an unbounded plane outside of the p.ImageWidth x p.ImageHeight window are not drawn.
+func Record(w io.Writer, p Params, events <-chan Event, next chan<- Event, o RecordOptions) error {
+	if next != nil {
+		defer close(next)
+	}
+	if o.Scale < 1 {
+		o.Scale = 1
+	}
+	if o.Delay <= 0 {
+		o.Delay = 100 * time.Millisecond
+	}
+	rule := p.Rule.orDefault()
+	palette := o.Palette
+	if palette == nil {
+		palette = statePalette(p)
+	}
+
+	board := image.NewPaletted(image.Rect(0, 0, p.ImageWidth*o.Scale, p.ImageHeight*o.Scale), palette)
+	var frames []*image.Paletted
+	lastFrame := -1
+	changed := false
+	paint := func(c util.Cell, value uint8) {
+		if c.X < 0 || c.Y < 0 || c.X >= p.ImageWidth || c.Y >= p.ImageHeight {
+			return
+		}
+		index := uint8(len(palette) - 1)
+		if state := rule.state(value); state < len(palette) {
+			index = uint8(state)
+		}
+		cell := image.Rect(c.X, c.Y, c.X+1, c.Y+1)
+		for y := cell.Min.Y * o.Scale; y < cell.Max.Y*o.Scale; y++ {
+			for x := cell.Min.X * o.Scale; x < cell.Max.X*o.Scale; x++ {
+				board.SetColorIndex(x, y, index)
+			}
+		}
+		changed = true
+	}
+	for event := range events {
+		switch e := event.(type) {
+		case CellFlipped:
+			paint(e.Cell, e.Value)
+		case TurnDiff:
+			for i, cell := range e.Cells {
+				paint(cell, e.Values[i])
+			}
+		case TurnComplete:
+			full := o.MaxFrames > 0 && len(frames) >= o.MaxFrames
+			if !full && (lastFrame < 0 || e.CompletedTurns-lastFrame >= o.Stride) {
+				frames = append(frames, copyPaletted(board))
+				lastFrame = e.CompletedTurns
+				changed = false
+			}
+		}
+		if next != nil {
+			next <- event
+		}
+	}
+	// The board the run ended on is always shown last, if there is room for it.
+	if len(frames) == 0 || changed && (o.MaxFrames == 0 || len(frames) < o.MaxFrames) {
+		frames = append(frames, copyPaletted(board))
+	}
+
+	if o.Format == APNG {
+		return writeApng(w, frames, o.Delay)
+	}
+	animation := gif.GIF{Image: frames}
+	for range frames {
+		animation.Delay = append(animation.Delay, int(o.Delay/(10*time.Millisecond)))
+	}
+	return gif.EncodeAll(w, &animation)
+}
+
+// copyPaletted returns a copy of a paletted image sharing its palette.
+func copyPaletted(m *image.Paletted) *image.Paletted {
+	c := image.NewPaletted(m.Rect, m.Palette)
+	copy(c.Pix, m.Pix)
+	return c
+}
+
+// writeApng writes frames as an animated PNG that loops forever. Every frame is encoded by image/png,
+// and its image data is copied into the animation: the IDAT chunks of the first frame, which is also the default image,
+// and fdAT chunks for the others, each frame preceded by an fcTL chunk holding its size and delay.
+func writeApng(w io.Writer, frames []*image.Paletted, delay time.Duration) error {
+	milliseconds := delay / time.Millisecond
+	if milliseconds > 65535 {
+		milliseconds = 65535
+	}
+	b := &bytes.Buffer{}
+	b.WriteString(pngSignature)
+	sequence := uint32(0)
+	for i, frame := range frames {
+		var encoded bytes.Buffer
+		if err := png.Encode(&encoded, frame); err != nil {
+			return err
+		}
+		chunks, err := pngChunks(encoded.Bytes())
+		if err != nil {
+			return err
+		}
+		if i == 0 {
+			// The header and palette of the first frame are those of the animation.
+			for _, chunk := range chunks {
+				if chunk.kind == "IDAT" || chunk.kind == "IEND" {
+					continue
+				}
+				writePngChunk(b, chunk.kind, chunk.data)
+				if chunk.kind == "IHDR" {
+					writePngChunk(b, "acTL", pngUint32s(uint32(len(frames)), 0))
+				}
+			}
+		}
+
+		// The delay is a fraction of a second in milliseconds, and the frame is neither disposed of nor blended.
+		control := pngUint32s(sequence, uint32(frame.Rect.Dx()), uint32(frame.Rect.Dy()), 0, 0)
+		control = append(control, byte(milliseconds>>8), byte(milliseconds), 1000>>8, 1000&0xff, 0, 0)
+		writePngChunk(b, "fcTL", control)
+		sequence++
+		for _, chunk := range chunks {
+			if chunk.kind != "IDAT" {
+				continue
+			}
+			if i == 0 {
+				writePngChunk(b, "IDAT", chunk.data)
+			} else {
+				writePngChunk(b, "fdAT", append(pngUint32s(sequence), chunk.data...))
+				sequence++
+			}
+		}
+	}
+	writePngChunk(b, "IEND", nil)
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+// pngSignature starts every PNG file.
+const pngSignature = "\x89PNG\r\n\x1a\n"
+
+// pngChunk is a chunk of a PNG file.
+type pngChunk struct {
+	kind string
+	data []byte
+}
+
+// pngChunks splits a PNG file into its chunks.
+func pngChunks(data []byte) ([]pngChunk, error) {
+	if !bytes.HasPrefix(data, []byte(pngSignature)) {
+		return nil, errors.New("not a png file")
+	}
+	var chunks []pngChunk
+	data = data[len(pngSignature):]
+	for len(data) >= 12 {
+		length := binary.BigEndian.Uint32(data)
+		if uint32(len(data)-12) < length {
+			break
+		}
+		chunks = append(chunks, pngChunk{kind: string(data[4:8]), data: data[8 : 8+length]})
+		data = data[12+length:]
+	}
+	if len(data) != 0 {
+		return nil, errors.New("truncated png")
+	}
+	return chunks, nil
+}
+
+// writePngChunk writes a chunk with its length and checksum.
+func writePngChunk(b *bytes.Buffer, kind string, data []byte) {
+	b.Write(pngUint32s(uint32(len(data))))
+	crc := crc32.NewIEEE()
+	crc.Write([]byte(kind))
+	crc.Write(data)
+	b.WriteString(kind)
+	b.Write(data)
+	b.Write(pngUint32s(crc.Sum32()))
+}
+
+// pngUint32s returns numbers as big endian bytes.
+func pngUint32s(numbers ...uint32) []byte {
+	b := make([]byte, 4*len(numbers))
+	for i, n := range numbers {
+		binary.BigEndian.PutUint32(b[4*i:], n)
+	}
+	return b
+}
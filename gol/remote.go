@@ -0,0 +1,323 @@
+package gol
+
+import (
+	"errors"
+	"net"
+	"net/rpc"
+	"sync"
+	"time"
+
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// StripRequest asks a worker process for the next generation of a strip of rows.
+// Strip holds the rows Start-1 to Start+n, each padded with one cell at both ends,
+// so that every cell of the n rows of the strip has all of its neighbours in it.
+type StripRequest struct {
+	Rule  Rule
+	Strip [][]uint8
+	Start int
+	Turn  int
+}
+
+// StripResponse is the next generation of the rows of a strip, without the padding, and the cells that flipped.
+type StripResponse struct {
+	Strip   [][]uint8
+	Flipped []CellFlipped
+}
+
+// StripWorker is the net/rpc service of a worker process, which computes strips of a world for a broker.
+type StripWorker struct{}
+
+// Calculate computes the next generation of a padded strip.
+func (w *StripWorker) Calculate(req StripRequest, res *StripResponse) error {
+	res.Strip = make([][]uint8, len(req.Strip)-2)
+	for i := range res.Strip {
+		res.Strip[i] = make([]uint8, len(req.Strip[0])-2)
+		for x := range res.Strip[i] {
+			value := req.Strip[i+1][x+1]
+			newValue := req.Rule.next(value, calculateNeighbours(i+1, x+1, req.Strip))
+			res.Strip[i][x] = newValue
+			if newValue != value {
+				res.Flipped = append(res.Flipped, CellFlipped{
+					CompletedTurns: req.Turn,
+					Cell:           util.Cell{X: x, Y: req.Start + i},
+					Value:          newValue,
+				})
+			}
+		}
+	}
+	return nil
+}
+
+// Ping answers the heartbeats of a dispatcher.
+func (w *StripWorker) Ping(req struct{}, res *struct{}) error {
+	return nil
+}
+
+// ServeWorker serves the services of a worker process, for brokers and for peer-to-peer runs, on a listener until it is closed.
+func ServeWorker(l net.Listener) error {
+	server := rpc.NewServer()
+	if err := server.Register(new(StripWorker)); err != nil {
+		return err
+	}
+	if err := server.Register(newPeer()); err != nil {
+		return err
+	}
+	server.Accept(l)
+	return nil
+}
+
+// getPaddedStrip returns the rows start-1 to end of the world, each padded with one cell at both ends.
+// The halo rows and padding cells are taken from across the edges of the world according to the topology.
+func getPaddedStrip(world [][]uint8, start, end int, t Topology) [][]uint8 {
+	width := len(world[0])
+	strip := make([][]uint8, end-start+2)
+	for i := range strip {
+		strip[i] = make([]uint8, width+2)
+		for x := -1; x <= width; x++ {
+			strip[i][x+1] = cellAt(world, x, start-1+i, t)
+		}
+	}
+	return strip
+}
+
+// Heartbeats are sent to every worker process every heartbeatInterval.
+// A worker that does not answer one within heartbeatTimeout is lost.
+const (
+	heartbeatInterval = 100 * time.Millisecond
+	heartbeatTimeout  = time.Second
+)
+
+// remoteWorker is a connection to a worker process.
+type remoteWorker struct {
+	address  string
+	client   *rpc.Client
+	lost     bool
+	reported bool
+}
+
+// stripDispatcher splits the turns of a world into strips, which it sends to worker processes.
+// The world is only replaced once every strip of a turn has been computed, so when a worker process is lost,
+// by failing a call or missing a heartbeat, its strips are computed again by the other workers from the last complete turn.
+// Workers without a strip are spares, which take over the strips of a lost worker first.
+type stripDispatcher struct {
+	mu      sync.Mutex
+	workers []*remoteWorker
+	stop    chan bool
+	// notify is called with the WorkerLost and WorkerRecovered events.
+	notify func(Event)
+}
+
+// dialWorkers connects to the worker processes and starts sending them heartbeats.
+func dialWorkers(addresses []string, notify func(Event)) (*stripDispatcher, error) {
+	d := &stripDispatcher{stop: make(chan bool), notify: notify}
+	for _, address := range addresses {
+		client, err := rpc.Dial("tcp", address)
+		if err != nil {
+			d.close()
+			return nil, err
+		}
+		d.workers = append(d.workers, &remoteWorker{address: address, client: client})
+	}
+	for _, w := range d.workers {
+		go d.heartbeat(w)
+	}
+	return d, nil
+}
+
+// close stops the heartbeats and closes the connections.
+func (d *stripDispatcher) close() {
+	close(d.stop)
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, w := range d.workers {
+		w.client.Close()
+	}
+}
+
+func (d *stripDispatcher) heartbeat(w *remoteWorker) {
+	for {
+		select {
+		case <-d.stop:
+			return
+		case <-time.After(heartbeatInterval):
+		}
+		call := w.client.Go("StripWorker.Ping", struct{}{}, new(struct{}), nil)
+		select {
+		case <-d.stop:
+			return
+		case <-call.Done:
+			if call.Error == nil {
+				continue
+			}
+		case <-time.After(heartbeatTimeout):
+		}
+		d.lose(w)
+		return
+	}
+}
+
+// lose marks a worker as lost and closes its connection, so that any call still waiting for it fails.
+func (d *stripDispatcher) lose(w *remoteWorker) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if !w.lost {
+		w.lost = true
+		w.client.Close()
+	}
+}
+
+// live returns the workers that have not been lost, reporting the newly lost workers with WorkerLost events.
+func (d *stripDispatcher) live(turn int) (live, lost []*remoteWorker) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, w := range d.workers {
+		if !w.lost {
+			live = append(live, w)
+		} else if !w.reported {
+			w.reported = true
+			lost = append(lost, w)
+		}
+	}
+	return live, lost
+}
+
+// step computes the next generation of the world in p.Threads strips, at most one per row,
+// which are shared between the live workers in turn.
+func (d *stripDispatcher) step(p Params, world [][]uint8, turn int) ([][]uint8, []CellFlipped, error) {
+	height := len(world)
+	strips := p.Threads
+	if strips > height {
+		strips = height
+	}
+
+	results := make([]*StripResponse, strips)
+	pending := make([]int, strips)
+	for i := range pending {
+		pending[i] = i
+	}
+	var recovering []*remoteWorker
+	used := make(map[*remoteWorker]bool)
+	for len(pending) > 0 {
+		live, lost := d.live(turn)
+		for _, w := range lost {
+			d.notify(WorkerLost{CompletedTurns: turn, Worker: w.address})
+		}
+		recovering = append(recovering, lost...)
+		if len(live) == 0 {
+			return nil, nil, errors.New("all worker processes have been lost")
+		}
+		// Strips are computed again by spares before the workers that already have a strip.
+		var idle, busy []*remoteWorker
+		for _, w := range live {
+			if used[w] {
+				busy = append(busy, w)
+			} else {
+				idle = append(idle, w)
+			}
+		}
+		live = append(idle, busy...)
+
+		calls := make([]*rpc.Call, len(pending))
+		workers := make([]*remoteWorker, len(pending))
+		for j, i := range pending {
+			start, end := i*height/strips, (i+1)*height/strips
+			req := StripRequest{
+				Rule:  p.Rule,
+				Strip: getPaddedStrip(world, start, end, p.Topology),
+				Start: start,
+				Turn:  turn,
+			}
+			workers[j] = live[j%len(live)]
+			used[workers[j]] = true
+			calls[j] = workers[j].client.Go("StripWorker.Calculate", req, new(StripResponse), nil)
+		}
+
+		var failed []int
+		for j, call := range calls {
+			<-call.Done
+			if call.Error != nil {
+				d.lose(workers[j])
+				failed = append(failed, pending[j])
+				continue
+			}
+			results[pending[j]] = call.Reply.(*StripResponse)
+		}
+		pending = failed
+	}
+
+	var newWorld [][]uint8
+	var flipped []CellFlipped
+	for _, res := range results {
+		newWorld = append(newWorld, res.Strip...)
+		flipped = append(flipped, res.Flipped...)
+	}
+	for _, w := range recovering {
+		d.notify(WorkerRecovered{CompletedTurns: turn, Worker: w.address})
+	}
+	return newWorld, flipped, nil
+}
+
+// calculateWorldWorkers executes all turns on the worker processes at p.Workers, which the distributor supervises itself.
+// A lost worker process is reported with a WorkerLost event and a WorkerRecovered event once its strips have been
+// computed by the others. If a worker process cannot be reached or every one of them is lost, the run ends with a RunFailed event,
+// writing out the world reached.
+func calculateWorldWorkers(p Params, c distributorChannels, world [][]uint8, start int) {
+	dispatcher, err := dialWorkers(p.Workers, func(event Event) { c.events <- event })
+	if err != nil {
+		failRun(c, start, err, nil)
+		return
+	}
+	defer dispatcher.close()
+
+	ticker := createTicker(2 * time.Second)
+	done := make(chan bool)
+	var turn int
+	numberAlive := len(getCurrentAliveCells(world))
+
+	tickerRun(c, &turn, &numberAlive, done, ticker)
+
+	checkpoints := newCheckpointer(p, start)
+	save := func() {
+		writePgm(p, c, turn, world)
+		writeWorldCheckpoint(p, c, turn, world)
+	}
+	for turn = start; turn < p.Turns; turn++ {
+
+		if manageSdlInput(p, c, &turn, save, done, ticker, &numberAlive) {
+			return
+		}
+		if checkpoints.due(turn) {
+			writeWorldCheckpoint(p, c, turn, world)
+		}
+
+		newWorld, flipped, err := dispatcher.step(p, world, turn)
+		if err != nil {
+			ticker.stopTicker(done)
+			failRun(c, turn, err, save)
+			return
+		}
+		world = newWorld
+		var diff flips
+		for _, event := range flipped {
+			diff.add(event.Cell.X, event.Cell.Y, event.Value)
+		}
+		diff.send(p, c, turn)
+
+		c.events <- TurnComplete{
+			CompletedTurns: turn,
+		}
+		numberAlive = len(getCurrentAliveCells(world))
+	}
+
+	writePgm(p, c, p.Turns, world)
+
+	c.events <- FinalTurnComplete{
+		CompletedTurns: p.Turns,
+		Alive:          getCurrentAliveCells(world),
+		Dying:          getCurrentDyingCells(world),
+	}
+
+	closeProgramm(c, p.Turns, done, ticker)
+}
@@ -0,0 +1,202 @@
+package gol
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Rule describes an outer-totalistic Life-like rule.
+// Birth[n] is true if a dead cell with n alive neighbours becomes alive,
+// Survival[n] is true if an alive cell with n alive neighbours stays alive.
+// States is the number of cell states of a Generations rule: an alive cell that does not survive
+// decays through States-2 refractory (dying) states before it is dead. 0 or 2 means a two-state rule.
+// The zero Rule is treated as Conway's Game of Life (B3/S23).
+type Rule struct {
+	Birth    [9]bool
+	Survival [9]bool
+	States   int
+}
+
+// Conway is the standard Game of Life rule, B3/S23.
+var Conway = Rule{
+	Birth:    [9]bool{3: true},
+	Survival: [9]bool{2: true, 3: true},
+}
+
+// ParseRule parses a rulestring in B/S notation (B36/S23, b3s23) or S/B notation (23/36).
+// Generations rules add the number of states as a third part, e.g. B2/S/C3 or /2/3 for Brian's Brain.
+func ParseRule(s string) (Rule, error) {
+	var r Rule
+	rs := strings.ToUpper(strings.TrimSpace(s))
+	if rs == "" {
+		return r, fmt.Errorf("empty rulestring")
+	}
+
+	var birth, survival, states string
+	if strings.HasPrefix(rs, "B") || strings.HasPrefix(rs, "S") {
+		// B/S notation. The parts may come in either order and the slash is optional.
+		for _, part := range splitRule(rs) {
+			switch part[0] {
+			case 'B':
+				birth = part[1:]
+			case 'S':
+				survival = part[1:]
+			case 'C', 'G':
+				states = part[1:]
+			default:
+				if states != "" || part[0] < '0' || part[0] > '9' {
+					return r, fmt.Errorf("invalid rulestring %q", s)
+				}
+				states = part
+			}
+		}
+	} else {
+		// S/B notation, e.g. 23/3, or S/B/C notation, e.g. 345/2/4.
+		parts := strings.Split(rs, "/")
+		if len(parts) != 2 && len(parts) != 3 {
+			return r, fmt.Errorf("invalid rulestring %q", s)
+		}
+		survival, birth = parts[0], parts[1]
+		if len(parts) == 3 {
+			states = parts[2]
+		}
+	}
+
+	if states != "" {
+		n, err := strconv.Atoi(states)
+		if err != nil || n < 2 || n > 256 {
+			return r, fmt.Errorf("invalid rulestring %q: number of states must be between 2 and 256", s)
+		}
+		if n > 2 {
+			r.States = n
+		}
+	}
+
+	if err := parseCounts(birth, &r.Birth); err != nil {
+		return r, fmt.Errorf("invalid rulestring %q: %v", s, err)
+	}
+	if err := parseCounts(survival, &r.Survival); err != nil {
+		return r, fmt.Errorf("invalid rulestring %q: %v", s, err)
+	}
+	if r == (Rule{}) {
+		return r, fmt.Errorf("invalid rulestring %q: no birth or survival conditions", s)
+	}
+	return r, nil
+}
+
+// splitRule splits B/S notation into its parts, e.g. "B3S23" -> ["B3", "S23"], "B2/S/3" -> ["B2", "S", "3"].
+func splitRule(rs string) []string {
+	var parts []string
+	start := 0
+	for i := 1; i <= len(rs); i++ {
+		if i == len(rs) || strings.IndexByte("BSCG/", rs[i]) >= 0 {
+			if part := strings.Trim(rs[start:i], "/"); part != "" {
+				parts = append(parts, part)
+			}
+			start = i
+		}
+	}
+	return parts
+}
+
+func parseCounts(digits string, counts *[9]bool) error {
+	for _, d := range digits {
+		if d < '0' || d > '8' {
+			return fmt.Errorf("invalid neighbour count %q", d)
+		}
+		counts[d-'0'] = true
+	}
+	return nil
+}
+
+// String returns the rule in canonical B/S notation.
+func (r Rule) String() string {
+	var b strings.Builder
+	b.WriteString("B")
+	for n, ok := range r.orDefault().Birth {
+		if ok {
+			fmt.Fprint(&b, n)
+		}
+	}
+	b.WriteString("/S")
+	for n, ok := range r.orDefault().Survival {
+		if ok {
+			fmt.Fprint(&b, n)
+		}
+	}
+	if r.States > 2 {
+		fmt.Fprintf(&b, "/C%d", r.States)
+	}
+	return b.String()
+}
+
+func (r Rule) orDefault() Rule {
+	if r == (Rule{}) {
+		return Conway
+	}
+	return r
+}
+
+// Cells are stored as grey levels: dead cells are 0, alive cells are 255
+// and the refractory states of Generations rules fade from light to dark grey in between.
+
+// stateCount returns the number of cell states, which is 2 for two-state rules.
+func (r Rule) stateCount() int {
+	if r.States < 2 {
+		return 2
+	}
+	return r.States
+}
+
+// value returns the grey level of a state: 0 is dead, 1 is alive and 2..States-1 are dying.
+func (r Rule) value(state int) uint8 {
+	switch state {
+	case 0:
+		return dead
+	case 1:
+		return alive
+	}
+	n := r.stateCount()
+	return uint8(255 * (n - state) / (n - 1))
+}
+
+// state returns the state closest to the given grey level.
+func (r Rule) state(value uint8) int {
+	switch {
+	case value == dead:
+		return 0
+	case value == alive || r.stateCount() == 2:
+		return 1
+	}
+	n := r.stateCount()
+	state := n - (int(value)*(n-1)+127)/255
+	if state < 2 {
+		state = 2
+	} else if state > n-1 {
+		state = n - 1
+	}
+	return state
+}
+
+// normalise maps an arbitrary grey level read from an image to the value of the closest state.
+func (r Rule) normalise(value uint8) uint8 {
+	return r.value(r.state(value))
+}
+
+// next returns the new value of a cell given its current value and the number of alive neighbours.
+func (r Rule) next(cell uint8, neighbours int) uint8 {
+	switch cell {
+	case alive:
+		if r.Survival[neighbours] {
+			return alive
+		}
+		return r.value(2 % r.stateCount())
+	case dead:
+		if r.Birth[neighbours] {
+			return alive
+		}
+		return dead
+	}
+	return r.value((r.state(cell) + 1) % r.stateCount())
+}
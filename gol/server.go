@@ -0,0 +1,247 @@
+package gol
+
+import (
+	"encoding/gob"
+	"image/color"
+	"net"
+	"sync"
+	"time"
+
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+func init() {
+	// Events are sent to viewers as interface values, so every type of Event has to be registered with gob.
+	gob.Register(AliveCellsCount{})
+	gob.Register(ImageOutputComplete{})
+	gob.Register(StateChange{})
+	gob.Register(CellFlipped{})
+	gob.Register(TurnDiff{})
+	gob.Register(TurnComplete{})
+	gob.Register(FinalTurnComplete{})
+	gob.Register(TileStats{})
+	gob.Register(WorkerLost{})
+	gob.Register(WorkerRecovered{})
+	gob.Register(RunFailed{})
+	// The colours of the palette of the Params are interface values too.
+	gob.Register(color.RGBA{})
+	gob.Register(color.Gray{})
+}
+
+// viewerHello is the first message sent to a viewer: the parameters of the simulation,
+// the last completed turn and every cell of the board that is not dead.
+type viewerHello struct {
+	Params         Params
+	CompletedTurns int
+	Cells          []CellFlipped
+}
+
+// eventMessage holds an event sent to a viewer, as gob only encodes interface values held in a struct.
+type eventMessage struct {
+	Event Event
+}
+
+// viewerQueue is the number of events queued for a viewer. A viewer that falls further behind is disconnected,
+// so that a slow viewer never holds up the simulation.
+const viewerQueue = 1000
+
+// viewerTimeout is how long the viewers are given to receive the events queued for them once the simulation has finished.
+const viewerTimeout = 5 * time.Second
+
+// viewer is the connection of an attached viewer and the events queued for it.
+type viewer struct {
+	conn   net.Conn
+	events chan Event
+}
+
+// Serve runs the simulation headless and serves the viewers that attach with Attach on a listener.
+// The simulation keeps running while no viewer is attached. A viewer pressing 'q' is only detached,
+// while 'k' from any viewer writes the final PGM and shuts the simulation down.
+// A viewer that falls more than viewerQueue events behind is disconnected.
+// The listener is closed and Serve returns once the simulation has finished and the viewers have received its last events.
+func Serve(l net.Listener, p Params) error {
+	p, err := resumeParams(p)
+	if err != nil {
+		return err
+	}
+	if err := CheckParams(p); err != nil {
+		return err
+	}
+	if p, err = ReadInput(p); err != nil {
+		return err
+	}
+	events := make(chan Event, 1000)
+	keyPresses := make(chan rune, 10)
+	Run(p, events, keyPresses)
+
+	attach := make(chan net.Conn)
+	detach := make(chan *viewer)
+	finished := make(chan bool)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			select {
+			case attach <- conn:
+			case <-finished:
+				conn.Close()
+				return
+			}
+		}
+	}()
+
+	// The board and the turn are kept up to date from the events, so that a viewer can be sent them when it attaches.
+	board := make(map[util.Cell]uint8)
+	turn := 0
+	viewers := make(map[*viewer]bool)
+	var writers sync.WaitGroup
+	remove := func(v *viewer) {
+		if viewers[v] {
+			delete(viewers, v)
+			close(v.events)
+			v.conn.Close()
+		}
+	}
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				close(finished)
+				for v := range viewers {
+					v.conn.SetWriteDeadline(time.Now().Add(viewerTimeout))
+					close(v.events)
+				}
+				writers.Wait()
+				return l.Close()
+			}
+			switch e := event.(type) {
+			case CellFlipped:
+				if e.Value == dead {
+					delete(board, e.Cell)
+				} else {
+					board[e.Cell] = e.Value
+				}
+			case TurnDiff:
+				for i, cell := range e.Cells {
+					if e.Values[i] == dead {
+						delete(board, cell)
+					} else {
+						board[cell] = e.Values[i]
+					}
+				}
+			case TurnComplete:
+				turn = e.CompletedTurns
+			}
+			for v := range viewers {
+				select {
+				case v.events <- event:
+				default:
+					remove(v)
+				}
+			}
+
+		case conn := <-attach:
+			hello := viewerHello{Params: p, CompletedTurns: turn}
+			for cell, value := range board {
+				hello.Cells = append(hello.Cells, CellFlipped{turn, cell, value})
+			}
+			v := &viewer{conn, make(chan Event, viewerQueue)}
+			viewers[v] = true
+			writers.Add(1)
+			go func() {
+				defer writers.Done()
+				v.writeEvents(hello, detach, finished)
+			}()
+			go v.readKeys(keyPresses, detach, finished)
+
+		case v := <-detach:
+			remove(v)
+		}
+	}
+}
+
+// writeEvents sends the hello and then the queued events to the viewer until its queue is closed,
+// or detaches the viewer if the connection fails, and then closes the connection.
+func (v *viewer) writeEvents(hello viewerHello, detach chan<- *viewer, finished <-chan bool) {
+	defer v.conn.Close()
+	encoder := gob.NewEncoder(v.conn)
+	err := encoder.Encode(hello)
+	if err == nil {
+		for event := range v.events {
+			if err = encoder.Encode(eventMessage{event}); err != nil {
+				break
+			}
+		}
+	}
+	if err != nil {
+		select {
+		case detach <- v:
+		case <-finished:
+		}
+	}
+}
+
+// readKeys forwards the key presses of a viewer to the simulation until the viewer presses 'q' or disconnects.
+func (v *viewer) readKeys(keyPresses chan<- rune, detach chan<- *viewer, finished <-chan bool) {
+	decoder := gob.NewDecoder(v.conn)
+	for {
+		var key rune
+		if err := decoder.Decode(&key); err != nil || key == 'q' {
+			select {
+			case detach <- v:
+			case <-finished:
+			}
+			return
+		}
+		select {
+		case keyPresses <- key:
+		case <-finished:
+			return
+		}
+	}
+}
+
+// Attach connects a viewer to the server listening on the unix socket at path and returns the parameters of its simulation.
+// The current board is sent on events as CellFlipped events followed by a TurnComplete event for the last completed turn,
+// then the events of the simulation follow until the viewer detaches by pressing 'q' or the simulation finishes,
+// when events is closed. Every other key press is forwarded to the simulation.
+func Attach(path string, events chan<- Event, keyPresses <-chan rune) (Params, error) {
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		return Params{}, err
+	}
+	decoder := gob.NewDecoder(conn)
+	var hello viewerHello
+	if err := decoder.Decode(&hello); err != nil {
+		conn.Close()
+		return Params{}, err
+	}
+
+	go func() {
+		encoder := gob.NewEncoder(conn)
+		for key := range keyPresses {
+			if encoder.Encode(key) != nil {
+				return
+			}
+		}
+	}()
+
+	go func() {
+		defer close(events)
+		defer conn.Close()
+		for _, cell := range hello.Cells {
+			events <- cell
+		}
+		events <- TurnComplete{hello.CompletedTurns}
+		for {
+			var message eventMessage
+			if decoder.Decode(&message) != nil {
+				return
+			}
+			events <- message.Event
+		}
+	}()
+	return hello.Params, nil
+}
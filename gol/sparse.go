@@ -0,0 +1,252 @@
+package gol
+
+import (
+	"fmt"
+	"image"
+
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// Cells of an unbounded world are stored in square tiles of tileSize x tileSize cells.
+const (
+	tileShift = 6
+	tileSize  = 1 << tileShift
+)
+
+// tileKey is the position of a tile, in tiles. Tile (0,0) holds the cells (0,0) to (tileSize-1,tileSize-1).
+type tileKey struct {
+	x, y int
+}
+
+// tile is a block of cells indexed [y][x] with counts of its alive and non-dead cells.
+type tile struct {
+	cells [tileSize][tileSize]uint8
+	alive int
+	live  int
+}
+
+// sparseWorld is an unbounded world. Tiles are allocated when a cell in them comes alive
+// and freed when all of their cells are dead, so coordinates may be negative.
+type sparseWorld map[tileKey]*tile
+
+func tileOf(x, y int) (tileKey, int, int) {
+	return tileKey{x >> tileShift, y >> tileShift}, x & (tileSize - 1), y & (tileSize - 1)
+}
+
+func (w sparseWorld) get(x, y int) uint8 {
+	key, tx, ty := tileOf(x, y)
+	if t, ok := w[key]; ok {
+		return t.cells[ty][tx]
+	}
+	return dead
+}
+
+func (w sparseWorld) set(x, y int, value uint8) {
+	key, tx, ty := tileOf(x, y)
+	t, ok := w[key]
+	if !ok {
+		if value == dead {
+			return
+		}
+		t = new(tile)
+		w[key] = t
+	}
+	t.update(tx, ty, value)
+	if t.live == 0 {
+		delete(w, key)
+	}
+}
+
+func (t *tile) update(x, y int, value uint8) {
+	old := t.cells[y][x]
+	if old == alive {
+		t.alive--
+	}
+	if old != dead {
+		t.live--
+	}
+	if value == alive {
+		t.alive++
+	}
+	if value != dead {
+		t.live++
+	}
+	t.cells[y][x] = value
+}
+
+// touches reports whether the tile has an alive cell next to its neighbouring tile in direction (dx, dy),
+// i.e. whether cells may be born in that neighbour.
+func (t *tile) touches(dx, dy int) bool {
+	xs, ys := edge(dx), edge(dy)
+	for _, y := range ys {
+		for _, x := range xs {
+			if t.cells[y][x] == alive {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func edge(d int) []int {
+	switch d {
+	case -1:
+		return []int{0}
+	case 1:
+		return []int{tileSize - 1}
+	}
+	all := make([]int, tileSize)
+	for i := range all {
+		all[i] = i
+	}
+	return all
+}
+
+// population returns the number of alive cells.
+func (w sparseWorld) population() int {
+	n := 0
+	for _, t := range w {
+		n += t.alive
+	}
+	return n
+}
+
+// cells returns the cells for which match returns true.
+func (w sparseWorld) cells(match func(uint8) bool) []util.Cell {
+	var cells []util.Cell
+	for key, t := range w {
+		for y := range t.cells {
+			for x, value := range t.cells[y] {
+				if match(value) {
+					cells = append(cells, util.Cell{X: key.x<<tileShift + x, Y: key.y<<tileShift + y})
+				}
+			}
+		}
+	}
+	return cells
+}
+
+// bounds returns the smallest rectangle containing every cell that is not dead.
+func (w sparseWorld) bounds() image.Rectangle {
+	var r image.Rectangle
+	for _, cell := range w.cells(func(value uint8) bool { return value != dead }) {
+		r = r.Union(image.Rect(cell.X, cell.Y, cell.X+1, cell.Y+1))
+	}
+	return r
+}
+
+// candidates returns the tiles of the next generation that may hold cells which are not dead:
+// the tiles that exist now and the neighbours of tiles with alive cells on the shared edge.
+func (w sparseWorld) candidates() []tileKey {
+	seen := make(map[tileKey]bool)
+	var keys []tileKey
+	for key, t := range w {
+		for dy := -1; dy <= 1; dy++ {
+			for dx := -1; dx <= 1; dx++ {
+				k := tileKey{key.x + dx, key.y + dy}
+				if seen[k] {
+					continue
+				}
+				if (dx == 0 && dy == 0) || t.touches(dx, dy) {
+					seen[k] = true
+					keys = append(keys, k)
+				}
+			}
+		}
+	}
+	return keys
+}
+
+// calculateNextTile returns the next generation of the tile at key, or nil if all of its cells are dead,
+// and collects its flipped cells.
+func calculateNextTile(rule Rule, world sparseWorld, key tileKey, flipped *flips) *tile {
+	var neighbourhood [3][3]*tile
+	for dy := -1; dy <= 1; dy++ {
+		for dx := -1; dx <= 1; dx++ {
+			neighbourhood[dy+1][dx+1] = world[tileKey{key.x + dx, key.y + dy}]
+		}
+	}
+	at := func(x, y int) uint8 {
+		t := neighbourhood[(y>>tileShift)+1][(x>>tileShift)+1]
+		if t == nil {
+			return dead
+		}
+		return t.cells[y&(tileSize-1)][x&(tileSize-1)]
+	}
+
+	next := new(tile)
+	for y := 0; y < tileSize; y++ {
+		for x := 0; x < tileSize; x++ {
+			neighbours := 0
+			for i := -1; i <= 1; i++ {
+				for j := -1; j <= 1; j++ {
+					if (i != 0 || j != 0) && at(x+j, y+i) == alive {
+						neighbours++
+					}
+				}
+			}
+			value := at(x, y)
+			newValue := rule.next(value, neighbours)
+			if newValue != dead {
+				next.update(x, y, newValue)
+			}
+			if newValue != value {
+				flipped.add(key.x<<tileShift+x, key.y<<tileShift+y, newValue)
+			}
+		}
+	}
+	if next.live == 0 {
+		return nil
+	}
+	return next
+}
+
+// calculateNextSparseWorld computes the next generation of an unbounded world, splitting the candidate tiles between the workers.
+func calculateNextSparseWorld(p Params, c distributorChannels, world sparseWorld, turn int) sparseWorld {
+	keys := world.candidates()
+	results := make([]chan sparseWorld, p.Threads)
+	flipped := make([]flips, p.Threads)
+	for i := range results {
+		results[i] = make(chan sparseWorld)
+		go func(routineNumber int, keys []tileKey) {
+			part := make(sparseWorld)
+			for _, key := range keys {
+				select {
+				case value1 := <-c.stopResume[routineNumber]:
+					fmt.Println("Goroutine [", routineNumber, "] has stopped. Its value is: ", value1)
+					value2 := <-c.stopResume[routineNumber]
+					fmt.Println("Goroutine [", routineNumber, "] has resumed. Its value is: ", value2)
+				default:
+				}
+				if t := calculateNextTile(p.Rule, world, key, &flipped[routineNumber]); t != nil {
+					part[key] = t
+				}
+			}
+			results[routineNumber] <- part
+		}(i, keys[i*len(keys)/p.Threads:(i+1)*len(keys)/p.Threads])
+	}
+
+	newWorld := make(sparseWorld, len(world))
+	var diff flips
+	for i := range results {
+		for key, t := range <-results[i] {
+			newWorld[key] = t
+		}
+		diff.merge(&flipped[i])
+	}
+	diff.send(p, c, turn)
+	return newWorld
+}
+
+// sparseEngine runs the Cells engine on an unbounded plane.
+type sparseEngine struct {
+	sparseWorld
+	p Params
+	c distributorChannels
+}
+
+func (e *sparseEngine) next(turn, n int) {
+	for i := 0; i < n; i++ {
+		e.sparseWorld = calculateNextSparseWorld(e.p, e.c, e.sparseWorld, turn+i)
+	}
+}
@@ -0,0 +1,220 @@
+package gol
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Topology describes how the edges of the board are joined.
+// The zero Topology is a torus, which is what the Game of Life has always been simulated on.
+type Topology int
+
+const (
+	// Torus joins the left and right edges and the top and bottom edges (Golly's T).
+	Torus Topology = iota
+	// Plane is a bounded plane: cells beyond the edges are always dead (Golly's P).
+	Plane
+	// HorizontalCylinder joins the left and right edges, the top and bottom edges are dead (Golly's Tw,0).
+	HorizontalCylinder
+	// VerticalCylinder joins the top and bottom edges, the left and right edges are dead (Golly's T0,h).
+	VerticalCylinder
+	// KleinBottle joins the left and right edges normally and the top and bottom edges with a twist,
+	// i.e. a cell leaving through the top at column x comes back through the bottom at column width-1-x (Golly's Kw*,h).
+	KleinBottle
+	// KleinBottleTwistedSides joins the top and bottom edges normally and the left and right edges with a twist (Golly's Kw,h*).
+	KleinBottleTwistedSides
+	// CrossSurface joins both pairs of edges with a twist (Golly's C).
+	CrossSurface
+	// Sphere joins the top edge to the left edge and the bottom edge to the right edge (Golly's S).
+	// The board must be square.
+	Sphere
+	// Unbounded is an infinite plane (Golly's T0,0 or no suffix). The image is loaded at the origin
+	// and patterns are free to grow beyond it in every direction.
+	Unbounded
+)
+
+var topologyNames = map[Topology]string{
+	Torus:                   "torus",
+	Plane:                   "plane",
+	HorizontalCylinder:      "horizontal-cylinder",
+	VerticalCylinder:        "vertical-cylinder",
+	KleinBottle:             "klein-bottle",
+	KleinBottleTwistedSides: "klein-bottle-twisted-sides",
+	CrossSurface:            "cross-surface",
+	Sphere:                  "sphere",
+	Unbounded:               "unbounded",
+}
+
+func (t Topology) String() string {
+	if name, ok := topologyNames[t]; ok {
+		return name
+	}
+	return "Incorrect Topology"
+}
+
+// ParseTopology parses a topology either by name (torus, plane, klein-bottle...) or in Golly's notation:
+// T, P, K, C or S optionally followed by the board size, e.g. P512,512, T512,0 or K512*,512.
+// A zero size in a torus makes that axis bounded (a cylinder), or the whole board unbounded (T0,0),
+// and an asterisk marks the twisted axis of a Klein bottle.
+// Sizes other than zero must match the width and height of the board. Shifted edges are not supported.
+func ParseTopology(s string, width, height int) (Topology, error) {
+	s = strings.TrimPrefix(strings.TrimSpace(s), ":")
+	for t, name := range topologyNames {
+		if strings.EqualFold(s, name) {
+			return t, checkTopology(t, width, height)
+		}
+	}
+	if s == "" {
+		return Torus, fmt.Errorf("empty topology")
+	}
+
+	kind := strings.ToUpper(s[:1])
+	var t Topology
+	if s[1:] == "" {
+		switch kind {
+		case "T":
+			t = Torus
+		case "P":
+			t = Plane
+		case "K":
+			t = KleinBottle
+		case "C":
+			t = CrossSurface
+		case "S":
+			t = Sphere
+		default:
+			return Torus, fmt.Errorf("invalid topology %q", s)
+		}
+		return t, checkTopology(t, width, height)
+	}
+
+	dims := strings.Split(s[1:], ",")
+	if len(dims) != 2 {
+		return Torus, fmt.Errorf("invalid topology %q: expected a size such as %v,%v", s, width, height)
+	}
+	wTwisted := strings.HasSuffix(dims[0], "*")
+	hTwisted := strings.HasSuffix(dims[1], "*")
+	w, wErr := strconv.Atoi(strings.TrimSuffix(dims[0], "*"))
+	h, hErr := strconv.Atoi(strings.TrimSuffix(dims[1], "*"))
+	if wErr != nil || hErr != nil {
+		return Torus, fmt.Errorf("invalid topology %q: shifted or malformed size", s)
+	}
+	if (w != 0 && w != width) || (h != 0 && h != height) {
+		return Torus, fmt.Errorf("topology %q does not match the %vx%v board", s, width, height)
+	}
+	if (wTwisted || hTwisted) && (kind != "K" || wTwisted == hTwisted) {
+		return Torus, fmt.Errorf("invalid topology %q: only a Klein bottle has exactly one twisted axis", s)
+	}
+	if (w == 0 || h == 0) && kind != "T" {
+		return Torus, fmt.Errorf("invalid topology %q: only a torus may have a zero size", s)
+	}
+
+	switch {
+	case kind == "T" && w == 0 && h == 0:
+		t = Unbounded
+	case kind == "T" && h == 0:
+		t = HorizontalCylinder
+	case kind == "T" && w == 0:
+		t = VerticalCylinder
+	case kind == "T":
+		t = Torus
+	case kind == "P":
+		t = Plane
+	case kind == "K" && wTwisted:
+		t = KleinBottle
+	case kind == "K" && hTwisted:
+		t = KleinBottleTwistedSides
+	case kind == "C":
+		t = CrossSurface
+	case kind == "S":
+		t = Sphere
+	default:
+		return Torus, fmt.Errorf("invalid topology %q", s)
+	}
+	return t, checkTopology(t, width, height)
+}
+
+// golly returns the topology of a width x height board in Golly's notation, e.g. T512,512 or K512*,512.
+func (t Topology) golly(width, height int) string {
+	switch t {
+	case Torus:
+		return fmt.Sprintf("T%d,%d", width, height)
+	case Plane:
+		return fmt.Sprintf("P%d,%d", width, height)
+	case HorizontalCylinder:
+		return fmt.Sprintf("T%d,0", width)
+	case VerticalCylinder:
+		return fmt.Sprintf("T0,%d", height)
+	case KleinBottle:
+		return fmt.Sprintf("K%d*,%d", width, height)
+	case KleinBottleTwistedSides:
+		return fmt.Sprintf("K%d,%d*", width, height)
+	case CrossSurface:
+		return fmt.Sprintf("C%d,%d", width, height)
+	case Sphere:
+		return fmt.Sprintf("S%d,%d", width, height)
+	}
+	return "T0,0"
+}
+
+func checkTopology(t Topology, width, height int) error {
+	if t == Sphere && width != height {
+		return fmt.Errorf("a sphere needs a square board, not %vx%v", width, height)
+	}
+	return nil
+}
+
+// wrap maps the coordinates of a cell that may lie up to one cell beyond the edges of a width x height board
+// back onto the board. It returns false if the cell is beyond a dead edge.
+// Crossing a corner of a cross-surface or a sphere, where the joined edges meet in a single point, also counts as a dead edge.
+func (t Topology) wrap(x, y, width, height int) (int, int, bool) {
+	xOut := x < 0 || x >= width
+	yOut := y < 0 || y >= height
+	if !xOut && !yOut {
+		return x, y, true
+	}
+
+	switch t {
+	case Torus:
+		return mod(x, width), mod(y, height), true
+	case Plane:
+		return x, y, false
+	case HorizontalCylinder:
+		return mod(x, width), y, !yOut
+	case VerticalCylinder:
+		return x, mod(y, height), !xOut
+	case KleinBottle:
+		if yOut {
+			x, y = width-1-x, mod(y, height)
+		}
+		return mod(x, width), y, true
+	case KleinBottleTwistedSides:
+		if xOut {
+			x, y = mod(x, width), height-1-y
+		}
+		return x, mod(y, height), true
+	case CrossSurface:
+		if xOut && yOut {
+			return x, y, false
+		}
+		if xOut {
+			return mod(x, width), height - 1 - y, true
+		}
+		return width - 1 - x, mod(y, height), true
+	case Sphere:
+		switch {
+		case xOut && yOut:
+			return x, y, false
+		case y < 0:
+			return 0, x, true
+		case x < 0:
+			return y, 0, true
+		case y >= height:
+			return width - 1, x, true
+		default:
+			return y, height - 1, true
+		}
+	}
+	return x, y, false
+}
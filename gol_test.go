@@ -7,12 +7,16 @@ import (
 	"uk.ac.bris.cs/gameoflife/util"
 )
 
-// TestGol tests 16x16, 64x64 and 512x512 images on 0, 1 and 100 turns using 1-16 worker threads.
+// TestGol tests 16x16, 64x64 and 512x512 images, and non-square images whose heights are not divisible by
+// most thread counts, on 0, 1 and 100 turns using 1-16 worker threads and one worker thread per row.
 func TestGol(t *testing.T) {
 	tests := []gol.Params{
 		{ImageWidth: 16, ImageHeight: 16},
 		{ImageWidth: 64, ImageHeight: 64},
 		{ImageWidth: 512, ImageHeight: 512},
+		{ImageWidth: 500, ImageHeight: 37},
+		{ImageWidth: 37, ImageHeight: 500},
+		{ImageWidth: 123, ImageHeight: 45},
 	}
 	for _, p := range tests {
 		for _, turns := range []int{0, 1, 100} {
@@ -22,7 +26,11 @@ func TestGol(t *testing.T) {
 				p.ImageWidth,
 				p.ImageHeight,
 			)
-			for threads := 1; threads <= 16; threads++ {
+			threadCounts := []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16}
+			if p.ImageHeight > 16 {
+				threadCounts = append(threadCounts, p.ImageHeight)
+			}
+			for _, threads := range threadCounts {
 				p.Threads = threads
 				testName := fmt.Sprintf("%dx%dx%d-%d", p.ImageWidth, p.ImageHeight, p.Turns, p.Threads)
 				t.Run(testName, func(t *testing.T) {
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// TestHashLife runs the TestGol cases with the HashLife engine.
+func TestHashLife(t *testing.T) {
+	tests := []gol.Params{
+		{ImageWidth: 16, ImageHeight: 16},
+		{ImageWidth: 64, ImageHeight: 64},
+		{ImageWidth: 512, ImageHeight: 512},
+	}
+	for _, p := range tests {
+		p.Engine = gol.HashLife
+		p.Threads = 1
+		for _, turns := range []int{0, 1, 100} {
+			p.Turns = turns
+			expectedAlive := util.ReadAliveCells(
+				"check/images/"+fmt.Sprintf("%vx%vx%v.pgm", p.ImageWidth, p.ImageHeight, turns),
+				p.ImageWidth,
+				p.ImageHeight,
+			)
+			testName := fmt.Sprintf("%dx%dx%d", p.ImageWidth, p.ImageHeight, p.Turns)
+			t.Run(testName, func(t *testing.T) {
+				events := make(chan gol.Event)
+				gol.Run(p, events, nil)
+				var cells []util.Cell
+				for event := range events {
+					switch e := event.(type) {
+					case gol.FinalTurnComplete:
+						cells = e.Alive
+					}
+				}
+				assertEqualBoard(t, cells, expectedAlive, p)
+			})
+		}
+	}
+}
+
+// TestHashLifeSteps checks that HashLife completes the requested number of turns between TurnComplete events
+// and that its TurnDiff events keep a copy of the board up to date.
+func TestHashLifeSteps(t *testing.T) {
+	p := gol.Params{ImageWidth: 64, ImageHeight: 64, Turns: 100, Threads: 1, Engine: gol.HashLife, Step: 16}
+	expectedAlive := util.ReadAliveCells("check/images/64x64x100.pgm", p.ImageWidth, p.ImageHeight)
+
+	events := make(chan gol.Event)
+	gol.Run(p, events, nil)
+	board := make(map[util.Cell]bool)
+	var turns []int
+	for event := range events {
+		switch e := event.(type) {
+		case gol.TurnDiff:
+			for i, cell := range e.Cells {
+				board[cell] = e.Values[i] == 255
+			}
+		case gol.TurnComplete:
+			turns = append(turns, e.CompletedTurns)
+		}
+	}
+
+	expectedTurns := []int{15, 31, 47, 63, 79, 95, 99}
+	if fmt.Sprint(turns) != fmt.Sprint(expectedTurns) {
+		t.Errorf("TurnComplete events for turns %v, expected %v", turns, expectedTurns)
+	}
+	var cells []util.Cell
+	for cell, isAlive := range board {
+		if isAlive {
+			cells = append(cells, cell)
+		}
+	}
+	assertEqualBoard(t, cells, expectedAlive, p)
+}
+
+// TestHashLifeLongRun checks the number of alive cells of the 512x512 image after 10000 turns against check/alive.
+func TestHashLifeLongRun(t *testing.T) {
+	p := gol.Params{ImageWidth: 512, ImageHeight: 512, Turns: 10000, Threads: 1, Engine: gol.HashLife, Step: 1000}
+	alive := readAliveCounts(p.ImageWidth, p.ImageHeight)
+
+	events := make(chan gol.Event)
+	gol.Run(p, events, nil)
+	for event := range events {
+		switch e := event.(type) {
+		case gol.FinalTurnComplete:
+			if len(e.Alive) != alive[p.Turns] {
+				t.Errorf("At turn %v expected %v alive cells, got %v instead", p.Turns, alive[p.Turns], len(e.Alive))
+			}
+		}
+	}
+}
+
+// TestHashLifeUnbounded runs the TestUnbounded cases with the HashLife engine.
+func TestHashLifeUnbounded(t *testing.T) {
+	tests := []gol.Params{
+		{ImageWidth: 16, ImageHeight: 16, Turns: 100},
+		{ImageWidth: 64, ImageHeight: 64, Turns: 1000},
+	}
+	for _, p := range tests {
+		p.Topology = gol.Unbounded
+		p.Engine = gol.HashLife
+		p.Threads = 1
+		p.Step = 10
+		expectedAlive := readCellsCsv(fmt.Sprintf("check/unbounded/%vx%vx%v.csv", p.ImageWidth, p.ImageHeight, p.Turns))
+		t.Run(fmt.Sprintf("%dx%dx%d", p.ImageWidth, p.ImageHeight, p.Turns), func(t *testing.T) {
+			events := make(chan gol.Event)
+			gol.Run(p, events, nil)
+			var cells []util.Cell
+			for event := range events {
+				switch e := event.(type) {
+				case gol.FinalTurnComplete:
+					cells = e.Alive
+				}
+			}
+			assertEqualBoard(t, cells, expectedAlive, p)
+		})
+	}
+}
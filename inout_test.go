@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// TestInputOutput runs 100 turns from a copy of the 64x64 image outside images/, taking the size of the board
+// from the file, and writes the final board to a path of its own, with a snapshot next to it, to Stdout
+// and as a gzipped pbm image.
+func TestInputOutput(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gol")
+	util.Check(err)
+	defer os.RemoveAll(dir)
+	data, err := ioutil.ReadFile("images/64x64.pgm")
+	util.Check(err)
+	input := filepath.Join(dir, "start")
+	util.Check(ioutil.WriteFile(input, data, 0644))
+	expected := util.ReadAliveCells("check/images/64x64x100.pgm", 64, 64)
+
+	t.Run("path", func(t *testing.T) {
+		output := filepath.Join(dir, "final.rle")
+		p := gol.Params{Turns: 100, Threads: 4, Input: input, Output: output, OutputFormat: gol.RLE}
+		assertEqualBoard(t, runFinal(p).Alive, expected, gol.Params{ImageWidth: 64, ImageHeight: 64})
+
+		file, err := os.Open(output)
+		util.Check(err)
+		defer file.Close()
+		written, err := util.ReadRle(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if written.Width != 64 || written.Height != 64 {
+			t.Fatalf("Expected a 64x64 pattern, got %vx%v", written.Width, written.Height)
+		}
+	})
+
+	t.Run("snapshot", func(t *testing.T) {
+		output := filepath.Join(dir, "final.pgm")
+		p := gol.Params{Turns: 100, Threads: 4, Input: input, Output: output}
+		events := make(chan gol.Event)
+		keyPresses := make(chan rune, 1)
+		gol.Run(p, events, keyPresses)
+		snapshot := -1
+		for event := range events {
+			switch e := event.(type) {
+			case gol.TurnComplete:
+				if e.CompletedTurns == 39 {
+					keyPresses <- 's'
+				}
+			case gol.ImageOutputComplete:
+				if e.CompletedTurns != p.Turns {
+					snapshot = e.CompletedTurns
+				}
+			}
+		}
+		if snapshot < 0 {
+			t.Fatal("Expected a snapshot before the final image")
+		}
+		snapshotPath := filepath.Join(dir, fmt.Sprintf("final.%v.pgm", snapshot))
+		defer os.Remove(snapshotPath)
+		if _, err := os.Stat(snapshotPath); err != nil {
+			t.Fatalf("Expected the snapshot at %v, got %v", snapshotPath, err)
+		}
+		assertEqualBoard(t, util.ReadAliveCells(output, 64, 64), expected, gol.Params{ImageWidth: 64, ImageHeight: 64})
+	})
+
+	t.Run("quit", func(t *testing.T) {
+		// A run quit early writes the board it reached to the output, a path or stdout, rather than a snapshot.
+		var b bytes.Buffer
+		gol.Stdout = &b
+		defer func() { gol.Stdout = os.Stdout }()
+		for _, output := range []string{filepath.Join(dir, "quit.pgm"), "-"} {
+			p := gol.Params{Turns: 100, Threads: 4, Input: input, Output: output}
+			events := make(chan gol.Event)
+			keyPresses := make(chan rune, 1)
+			gol.Run(p, events, keyPresses)
+			quitAt := -1
+			for event := range events {
+				switch e := event.(type) {
+				case gol.TurnComplete:
+					if e.CompletedTurns == 39 {
+						keyPresses <- 'k'
+					}
+				case gol.StateChange:
+					quitAt = e.CompletedTurns
+				}
+			}
+			if quitAt < 40 || quitAt >= p.Turns {
+				t.Fatalf("Expected the run to quit part of the way through, it quit after %v turns", quitAt)
+			}
+			data := b.Bytes()
+			if output != "-" {
+				var err error
+				if data, err = ioutil.ReadFile(output); err != nil {
+					t.Fatalf("Expected the board to be written to %v, got %v", output, err)
+				}
+			}
+			if header, _, err := util.ParsePgm(data); err != nil || header.Width != 64 || header.Height != 64 {
+				t.Fatalf("Expected a 64x64 image written to %v, got %+v %v", output, header, err)
+			}
+			os.Remove(fmt.Sprintf("out/64x64x%v.pgm", quitAt))
+			os.Remove("out/64x64x100.checkpoint.pgm")
+		}
+	})
+
+	t.Run("stdout", func(t *testing.T) {
+		var b bytes.Buffer
+		gol.Stdout = &b
+		defer func() { gol.Stdout = os.Stdout }()
+		p := gol.Params{Turns: 100, Threads: 4, Input: input, Output: "-"}
+		runFinal(p)
+
+		header, raster, err := util.ParsePgm(b.Bytes())
+		if err != nil {
+			t.Fatal(err)
+		}
+		var cells []util.Cell
+		for i, value := range raster {
+			if value == 255 {
+				cells = append(cells, util.Cell{X: i % header.Width, Y: i / header.Width})
+			}
+		}
+		assertEqualBoard(t, cells, expected, gol.Params{ImageWidth: 64, ImageHeight: 64})
+	})
+
+	t.Run("gzip", func(t *testing.T) {
+		gzipped := filepath.Join(dir, "start.pgm.gz")
+		file, err := os.Create(gzipped)
+		util.Check(err)
+		w := gzip.NewWriter(file)
+		_, err = w.Write(data)
+		util.Check(err)
+		util.Check(w.Close())
+		util.Check(file.Close())
+
+		output := "out/64x64x100.pbm.gz"
+		defer os.Remove(output)
+		p := gol.Params{Turns: 100, Threads: 4, Input: gzipped, OutputFormat: gol.PBM, Compress: true}
+		assertEqualBoard(t, runFinal(p).Alive, expected, gol.Params{ImageWidth: 64, ImageHeight: 64})
+
+		info, err := os.Stat(output)
+		util.Check(err)
+		if info.Size() >= 64*64/8 {
+			t.Errorf("Expected a bit-packed and gzipped image smaller than %v bytes, got %v bytes", 64*64/8, info.Size())
+		}
+		assertEqualBoard(t, util.ReadAliveCells(output, 64, 64), expected, gol.Params{ImageWidth: 64, ImageHeight: 64})
+	})
+
+	t.Run("image size", func(t *testing.T) {
+		util.Check(ioutil.WriteFile("images/7x7.pgm", data, 0644))
+		defer os.Remove("images/7x7.pgm")
+		_, err := gol.ReadInput(gol.Params{ImageWidth: 7, ImageHeight: 7})
+		if err == nil || !strings.Contains(err.Error(), "is 64x64, not 7x7 like the board") {
+			t.Fatalf("Expected images/7x7.pgm not to match the 7x7 board, got %v", err)
+		}
+	})
+
+	t.Run("mismatch", func(t *testing.T) {
+		_, err := gol.ReadInput(gol.Params{ImageWidth: 16, ImageHeight: 16, Input: input})
+		if err == nil || !strings.Contains(err.Error(), "does not fit on the 16x16 board") {
+			t.Fatalf("Expected the 64x64 image not to fit on a 16x16 board, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// TestJSONEvents encodes one event of every type and checks its JSON object and that it decodes back into the event.
+func TestJSONEvents(t *testing.T) {
+	tests := []struct {
+		event gol.Event
+		json  string
+	}{
+		{gol.AliveCellsCount{CompletedTurns: 42, CellsCount: 5565}, `{"type":"AliveCellsCount","turn":42,"cells":5565}`},
+		{gol.ImageOutputComplete{CompletedTurns: 42, Filename: "64x64x42"}, `{"type":"ImageOutputComplete","turn":42,"filename":"64x64x42"}`},
+		{gol.StateChange{CompletedTurns: 42, NewState: gol.Paused}, `{"type":"StateChange","turn":42,"state":"Paused"}`},
+		{gol.CellFlipped{CompletedTurns: 42, Cell: util.Cell{X: 3, Y: 7}, Value: 255}, `{"type":"CellFlipped","turn":42,"x":3,"y":7,"value":255}`},
+		{gol.TurnDiff{CompletedTurns: 42, Cells: []util.Cell{{X: 3, Y: 7}, {X: 4, Y: 7}}, Values: []uint8{255, 0}}, `{"type":"TurnDiff","turn":42,"flipped":[[3,7,255],[4,7,0]]}`},
+		{gol.TurnComplete{CompletedTurns: 0}, `{"type":"TurnComplete","turn":0}`},
+		{gol.FinalTurnComplete{CompletedTurns: 100, Alive: []util.Cell{{X: 3, Y: 7}, {X: 4, Y: 7}}}, `{"type":"FinalTurnComplete","turn":100,"alive":[[3,7],[4,7]],"dying":[]}`},
+		{gol.TileStats{CompletedTurns: 42, Computed: 12, Skipped: 52}, `{"type":"TileStats","turn":42,"computed":12,"skipped":52}`},
+		{gol.WorkerLost{CompletedTurns: 42, Worker: "localhost:8031"}, `{"type":"WorkerLost","turn":42,"worker":"localhost:8031"}`},
+		{gol.WorkerRecovered{CompletedTurns: 43, Worker: "localhost:8031"}, `{"type":"WorkerRecovered","turn":43,"worker":"localhost:8031"}`},
+	}
+	for _, test := range tests {
+		data, err := gol.MarshalEvent(test.event)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != test.json {
+			t.Errorf("Expected %v to be encoded as %v, got %s", test.event, test.json, data)
+		}
+		event, err := gol.UnmarshalEvent(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(event, test.event) {
+			t.Errorf("Expected %s to be decoded as %#v, got %#v", data, test.event, event)
+		}
+	}
+	if len(tests) != len(gol.EventTypes) {
+		t.Errorf("Expected a test of each of the %v event types", len(gol.EventTypes))
+	}
+
+	for _, data := range []string{`{"type":"Unknown","turn":1}`, `{"type":"StateChange","turn":1,"state":"Running"}`, `not json`} {
+		if _, err := gol.UnmarshalEvent([]byte(data)); err == nil {
+			t.Errorf("Expected an error decoding %v", data)
+		}
+	}
+}
+
+// TestJSONLines streams 100 turns of the 64x64 image as JSON Lines, all of them, then only the turns and a sample
+// of the flipped cells, both with an event per cell and in TurnDiff events, and reads the streams back.
+func TestJSONLines(t *testing.T) {
+	stream := func(p gol.Params, o gol.JSONOptions) ([]gol.Event, []gol.Event) {
+		events := make(chan gol.Event)
+		forwarded := make(chan gol.Event)
+		var b bytes.Buffer
+		written := make(chan error, 1)
+		go func() { written <- gol.WriteJSONLines(&b, events, forwarded, o) }()
+		gol.Run(p, events, nil)
+		var run []gol.Event
+		for event := range forwarded {
+			run = append(run, event)
+		}
+		if err := <-written; err != nil {
+			t.Fatal(err)
+		}
+		read := make(chan gol.Event)
+		decoded := make(chan error, 1)
+		go func() { decoded <- gol.ReadJSONLines(strings.NewReader(b.String()), read) }()
+		var streamed []gol.Event
+		for event := range read {
+			streamed = append(streamed, event)
+		}
+		if err := <-decoded; err != nil {
+			t.Fatal(err)
+		}
+		return run, streamed
+	}
+
+	t.Run("all", func(t *testing.T) {
+		run, streamed := stream(gol.Params{Turns: 100, Threads: 4, ImageWidth: 64, ImageHeight: 64}, gol.JSONOptions{})
+		if !reflect.DeepEqual(streamed, run) {
+			t.Fatalf("Expected the %v events of the run, got %v events", len(run), len(streamed))
+		}
+		assertEqualBoard(t, boardAt(streamed, 99), util.ReadAliveCells("check/images/64x64x100.pgm", 64, 64), gol.Params{ImageWidth: 64, ImageHeight: 64})
+	})
+
+	t.Run("filtered", func(t *testing.T) {
+		types, err := gol.ParseEventTypes("TurnComplete, CellFlipped")
+		util.Check(err)
+		p := gol.Params{Turns: 100, Threads: 4, ImageWidth: 64, ImageHeight: 64, CellEvents: true}
+		run, streamed := stream(p, gol.JSONOptions{Types: types, Sample: 10})
+		flipped, sampled, turns := 0, 0, 0
+		for _, event := range run {
+			if _, ok := event.(gol.CellFlipped); ok {
+				flipped++
+			}
+		}
+		for _, event := range streamed {
+			switch event.(type) {
+			case gol.CellFlipped:
+				sampled++
+			case gol.TurnComplete:
+				turns++
+			default:
+				t.Fatalf("Expected only the filtered event types, got %v", event)
+			}
+		}
+		if turns != 100 || sampled != (flipped+9)/10 {
+			t.Fatalf("Expected 100 turns and %v of the %v flipped cells, got %v turns and %v cells", (flipped+9)/10, flipped, turns, sampled)
+		}
+	})
+
+	t.Run("sampled", func(t *testing.T) {
+		types, err := gol.ParseEventTypes("TurnComplete,TurnDiff")
+		util.Check(err)
+		p := gol.Params{Turns: 100, Threads: 4, ImageWidth: 64, ImageHeight: 64}
+		run, streamed := stream(p, gol.JSONOptions{Types: types, Sample: 10})
+		flipped, sampled, turns := 0, 0, 0
+		for _, event := range run {
+			if e, ok := event.(gol.TurnDiff); ok {
+				flipped += len(e.Cells)
+			}
+		}
+		for _, event := range streamed {
+			switch e := event.(type) {
+			case gol.TurnDiff:
+				if len(e.Cells) == 0 || len(e.Values) != len(e.Cells) {
+					t.Fatalf("Expected a sampled TurnDiff to hold cells, got %v", e)
+				}
+				sampled += len(e.Cells)
+			case gol.TurnComplete:
+				turns++
+			default:
+				t.Fatalf("Expected only the filtered event types, got %v", event)
+			}
+		}
+		if turns != 100 || sampled != (flipped+9)/10 {
+			t.Fatalf("Expected 100 turns and %v of the %v flipped cells, got %v turns and %v cells", (flipped+9)/10, flipped, turns, sampled)
+		}
+	})
+
+	if _, err := gol.ParseEventTypes("TurnComplete,Unknown"); err == nil {
+		t.Error("Expected an error for an unknown event type")
+	}
+}
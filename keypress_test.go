@@ -0,0 +1,54 @@
+package main
+
+import (
+	"os"
+	"testing"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+)
+
+// TestKeyPresses checks that the workers can be paused, resumed, snapshotted and quit part of the way through a run.
+func TestKeyPresses(t *testing.T) {
+	p := gol.Params{
+		Turns:       100000,
+		Threads:     4,
+		ImageWidth:  64,
+		ImageHeight: 64,
+	}
+	defer os.Remove("out/64x64x100000.checkpoint.pgm")
+
+	events := make(chan gol.Event)
+	keyPresses := make(chan rune)
+	gol.Run(p, events, keyPresses)
+	go func() {
+		for _, key := range "sppq" {
+			keyPresses <- key
+		}
+	}()
+
+	var got []string
+	filenames := make(map[string]bool)
+	for event := range events {
+		switch e := event.(type) {
+		case gol.StateChange:
+			got = append(got, e.NewState.String())
+		case gol.ImageOutputComplete:
+			got = append(got, "Output")
+			filenames[e.Filename] = true
+			defer os.Remove("out/" + e.Filename + ".pgm")
+		}
+	}
+	// The snapshot and the image written when quitting are named after the turns they were taken at.
+	if len(filenames) != 2 {
+		t.Errorf("Expected the snapshot and the final image to have different names, got %v", filenames)
+	}
+	expected := []string{"Output", "Paused", "Executing", "Output", "Quitting"}
+	if len(got) != len(expected) {
+		t.Fatalf("Expected the events %v, got %v", expected, got)
+	}
+	for i := range expected {
+		if got[i] != expected[i] {
+			t.Fatalf("Expected the events %v, got %v", expected, got)
+		}
+	}
+}
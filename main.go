@@ -3,7 +3,14 @@ package main
 import (
 	"flag"
 	"fmt"
+	"image"
+	"io"
+	"net"
+	"os"
 	"runtime"
+	"strconv"
+	"strings"
+	"time"
 
 	"uk.ac.bris.cs/gameoflife/gol"
 	"uk.ac.bris.cs/gameoflife/sdl"
@@ -38,15 +45,524 @@ func main() {
 		10000000000,
 		"Specify the number of turns to process. Defaults to 10000000000.")
 
+	ruleString := flag.String(
+		"rule",
+		"B3/S23",
+		"Specify the rule as a B/S or S/B rulestring, e.g. B36/S23, or a Generations rulestring, e.g. B2/S/C3. Defaults to B3/S23.")
+
+	topologyString := flag.String(
+		"topology",
+		"T",
+		"Specify how the edges of the board are joined in Golly's notation (T, P, K, C, S, e.g. T512,0 for a cylinder) "+
+			"or by name (torus, plane, horizontal-cylinder, vertical-cylinder, klein-bottle, klein-bottle-twisted-sides, "+
+			"cross-surface, sphere, unbounded). T0,0 or unbounded is an infinite plane. A topology suffix on the rule, e.g. B3/S23:P512,512, takes precedence. Defaults to T.")
+
+	engineString := flag.String(
+		"engine",
+		"cells",
+		"Specify the engine used to compute the turns: cells, hashlife or bitpacked. Defaults to cells.")
+
+	decompositionString := flag.String(
+		"decomposition",
+		"auto",
+		"Specify how the cells engine splits the board between the threads: strips of rows, a grid of rows and columns, or auto to pick from the shape of the board. Defaults to auto.")
+
+	flag.StringVar(
+		&params.Broker,
+		"broker",
+		"",
+		"Specify the address of a broker, e.g. 127.0.0.1:8030, to compute the turns on its worker processes. Defaults to computing them locally.")
+
+	peersString := flag.String(
+		"peers",
+		"",
+		"Specify the comma separated addresses of worker processes, e.g. 127.0.0.1:8031,127.0.0.1:8032, that each compute a strip of the board "+
+			"and exchange their edge rows directly. Defaults to computing the turns locally.")
+
+	workersString := flag.String(
+		"workers",
+		"",
+		"Specify the comma separated addresses of worker processes, e.g. 127.0.0.1:8031,127.0.0.1:8032, to send strips of the board to. "+
+			"The strips of a worker that is lost are computed by the others. Defaults to computing the turns locally.")
+
+	flag.StringVar(
+		&params.Input,
+		"in",
+		"",
+		"Specify the path of the file to start from, or - for stdin, in pbm, pgm, png, jpeg, RLE, plaintext (.cells), Life 1.05 or Life 1.06 format, which may be gzipped. "+
+			"The size of the board is taken from the file unless -w or -h is given, and the rule recorded in it replaces -rule. "+
+			"Defaults to images/<w>x<h>.pgm.")
+
+	flag.StringVar(
+		&params.Output,
+		"out",
+		"",
+		"Specify the path to write the final image to, or - for stdout, in the format of its extension "+
+			"(.pgm, .pbm, .png, .rle, .cells or .lif for Life 1.06, gzipped if followed by .gz) unless -format is given. "+
+			"The board is also written to it when quitting early with q or k. "+
+			"Snapshots taken with s are written next to it, named <stem>.<turn>.<format>, or to out/ for stdout. "+
+			"Defaults to out/<w>x<h>x<turn>.<format>.")
+
+	offsetString := flag.String(
+		"offset",
+		"",
+		"Specify the position x,y of the top left cell of the input on the board. "+
+			"Defaults to the position recorded in the input if it lies on the board there, or else the centre of the board.")
+
+	formatString := flag.String(
+		"format",
+		"pgm",
+		"Specify the format of the images written out: pgm, pbm (8 cells to a byte), png, rle, cells, life105 or life106. "+
+			"Defaults to the extension of -out, or pgm.")
+
+	paletteString := flag.String(
+		"palette",
+		"",
+		"Specify the colours of the dead, alive and dying states in png images, e.g. #000000,#ffffff. Images are read by matching "+
+			"the colours exactly, and written in them. Defaults to reading images by -threshold and writing them in grey levels.")
+
+	threshold := flag.Uint(
+		"threshold",
+		128,
+		"Specify the luminance from 1 to 255 from which the pixels of png and jpeg images are alive. Defaults to 128.")
+
+	flag.IntVar(
+		&params.Scale,
+		"scale",
+		1,
+		"Specify the width and height in pixels of a cell in the png images written. Defaults to 1.")
+
+	flag.BoolVar(
+		&params.Compress,
+		"gzip",
+		false,
+		"Specify whether to gzip the images written out, adding .gz to their names. Defaults to false.")
+
+	flag.BoolVar(
+		&params.CellEvents,
+		"cell-events",
+		false,
+		"Specify whether to send a CellFlipped event for every changed cell instead of a TurnDiff event per turn, "+
+			"e.g. for -jsonl consumers that read single cells. Defaults to false.")
+
+	checkpointString := flag.String(
+		"checkpoint-every",
+		"",
+		"Specify how often to write a checkpoint, either in turns, e.g. 100000, or as a duration, e.g. 10m. "+
+			"Checkpoints are also written on 's' and when quitting, next to -out as <stem>.checkpoint.pgm, or to out/ without it or for stdout. "+
+			"Defaults to only writing them on 's' and when quitting.")
+
+	flag.StringVar(
+		&params.Resume,
+		"resume",
+		"",
+		"Specify the path of a checkpoint to resume from. Its board, rule, topology, engine and decomposition replace the other flags, "+
+			"and so do its turns unless -turns is given.")
+
+	serve := flag.String(
+		"serve",
+		"",
+		"Specify the path of a unix socket to run the simulation headless on, e.g. /tmp/gol.sock. Viewers attach to it with -attach, "+
+			"'q' detaches a viewer and 'k' shuts the simulation down. Defaults to running the simulation with a viewer.")
+
+	attach := flag.String(
+		"attach",
+		"",
+		"Specify the unix socket of a headless simulation to attach a viewer to. The other flags are ignored.")
+
+	record := flag.String(
+		"record",
+		"",
+		"Specify the path of an animation of the run to write, an animated GIF (.gif) or PNG (.png or .apng). Defaults to none.")
+
+	recordStride := flag.Int(
+		"record-stride",
+		1,
+		"Specify the number of turns between the frames of the animation. Defaults to 1.")
+
+	recordScale := flag.Int(
+		"record-scale",
+		1,
+		"Specify the width and height in pixels of a cell in the animation. Defaults to 1.")
+
+	recordFrames := flag.Int(
+		"record-frames",
+		1000,
+		"Specify the largest number of frames in the animation, or 0 for no limit. Defaults to 1000.")
+
+	recordPalette := flag.String(
+		"record-palette",
+		"",
+		"Specify the colours of the dead, alive and dying states in the animation, e.g. #000000,#ffffff. Defaults to the grey levels of the pgm images.")
+
+	eventLog := flag.String(
+		"log",
+		"",
+		"Specify the path of a binary log of every event of the run to write, to be replayed with -replay. Defaults to none.")
+
+	logKeyframes := flag.Int(
+		"log-keyframes",
+		100,
+		"Specify the number of turns between the keyframes of the event log, which a replay seeks from. Defaults to 100.")
+
+	replay := flag.String(
+		"replay",
+		"",
+		"Specify the path of an event log written with -log to replay instead of running a simulation. The other flags are ignored.")
+
+	replaySpeed := flag.Float64(
+		"replay-speed",
+		1,
+		"Specify how many times faster than the run to replay the event log, or 0 for as fast as possible. Defaults to 1.")
+
+	replayFrom := flag.Int(
+		"replay-from",
+		0,
+		"Specify the turn to start the replay at. Defaults to the start of the log.")
+
+	jsonLines := flag.String(
+		"jsonl",
+		"",
+		"Specify where to write every event as a line of JSON: a path, - for stdout or unix:<path> for a unix socket "+
+			"that a dashboard is listening on. Defaults to none.")
+
+	jsonTypes := flag.String(
+		"jsonl-types",
+		"",
+		"Specify the comma separated event types written with -jsonl, e.g. AliveCellsCount,TurnComplete. Defaults to all of them.")
+
+	jsonSample := flag.Int(
+		"jsonl-sample",
+		1,
+		"Specify that one in every n flipped cells, of the TurnDiff or CellFlipped events, is written with -jsonl. Defaults to 1.")
+
+	headless := flag.Bool(
+		"headless",
+		false,
+		"Specify whether to run without a window. Defaults to false.")
+
+	flag.IntVar(
+		&params.Step,
+		"step",
+		1,
+		"Specify the number of turns between frames on an unbounded plane or with the hashlife engine. Defaults to 1.")
+
 	flag.Parse()
 
+	set := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+	// A resumed run completes the turns of its checkpoint unless -turns is given.
+	if params.Resume != "" && !set["turns"] {
+		params.Turns = 0
+	}
+
+	// The image or the events are the only thing written to stdout with -out - or -jsonl -,
+	// so every message is printed to stderr instead.
+	if params.Output == "-" && *jsonLines == "-" {
+		fmt.Fprintln(os.Stderr, "-out - and -jsonl - cannot both write to stdout")
+		os.Exit(2)
+	}
+	jsonOut := os.Stdout
+	if params.Output == "-" || *jsonLines == "-" {
+		gol.Stdout = os.Stdout
+		os.Stdout = os.Stderr
+	}
+
+	keyPresses := make(chan rune, 10)
+	events := make(chan gol.Event, 1000)
+
+	if *attach != "" {
+		params, err := gol.Attach(*attach, events, keyPresses)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		fmt.Println("Attached to", *attach)
+		sdl.Start(params, events, keyPresses)
+		return
+	}
+
+	if *replay != "" {
+		file, err := os.Open(*replay)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		defer file.Close()
+		log, err := gol.OpenEventLog(file)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		replayed := make(chan error, 1)
+		go func() {
+			replayed <- log.Replay(events, keyPresses, gol.ReplayOptions{Speed: *replaySpeed, From: *replayFrom})
+		}()
+		if *headless {
+			for range events {
+			}
+		} else {
+			sdl.Start(log.Params(), events, keyPresses)
+		}
+		if err := <-replayed; err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if i := strings.Index(*ruleString, ":"); i >= 0 {
+		*ruleString, *topologyString = (*ruleString)[:i], (*ruleString)[i+1:]
+	}
+
+	rule, err := gol.ParseRule(*ruleString)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	params.Rule = rule
+
+	if *threshold < 1 || *threshold > 255 {
+		fmt.Fprintf(os.Stderr, "invalid threshold %v\n", *threshold)
+		os.Exit(2)
+	}
+	params.Threshold = uint8(*threshold)
+	if *paletteString != "" {
+		if params.Palette, err = gol.ParsePalette(*paletteString); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+	}
+
+	if *offsetString != "" {
+		var offset image.Point
+		if n, _ := fmt.Sscanf(*offsetString, "%d,%d", &offset.X, &offset.Y); n != 2 {
+			fmt.Fprintf(os.Stderr, "invalid offset %q\n", *offsetString)
+			os.Exit(2)
+		}
+		params.InputOffset = &offset
+	}
+
+	if params.Input == "" && params.Resume == "" {
+		params.Input = fmt.Sprintf("images/%vx%v.pgm", params.ImageWidth, params.ImageHeight)
+	} else if params.Input != "" && !set["w"] && !set["h"] {
+		// The topology is checked against the size of the board, so the size is read from the input first.
+		params.ImageWidth, params.ImageHeight = 0, 0
+		if params, err = gol.ReadInput(params); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+	}
+
+	topology, err := gol.ParseTopology(*topologyString, params.ImageWidth, params.ImageHeight)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	params.Topology = topology
+
+	if params, err = gol.ReadInput(params); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	engine, err := gol.ParseEngine(*engineString)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	params.Engine = engine
+
+	for _, peer := range strings.Split(*peersString, ",") {
+		if peer = strings.TrimSpace(peer); peer != "" {
+			params.Peers = append(params.Peers, peer)
+		}
+	}
+	for _, worker := range strings.Split(*workersString, ",") {
+		if worker = strings.TrimSpace(worker); worker != "" {
+			params.Workers = append(params.Workers, worker)
+		}
+	}
+
+	decomposition, err := gol.ParseDecomposition(*decompositionString)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	params.Decomposition = decomposition
+
+	format, err := gol.ParseFormat(*formatString)
+	if !set["format"] && params.Output != "" && params.Output != "-" {
+		if format, err = gol.FormatOfPath(params.Output); err != nil {
+			err = fmt.Errorf("%v, use -format", err)
+		}
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	params.OutputFormat = format
+
+	if *checkpointString != "" {
+		if turns, err := strconv.Atoi(*checkpointString); err == nil && turns > 0 {
+			params.CheckpointTurns = turns
+		} else if period, err := time.ParseDuration(*checkpointString); err == nil && period > 0 {
+			params.CheckpointPeriod = period
+		} else {
+			fmt.Fprintf(os.Stderr, "invalid checkpoint interval %q\n", *checkpointString)
+			os.Exit(2)
+		}
+	}
+
+	if err := gol.CheckParams(params); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
 	fmt.Println("Threads:", params.Threads)
 	fmt.Println("Width:", params.ImageWidth)
 	fmt.Println("Height:", params.ImageHeight)
+	fmt.Println("Rule:", params.Rule)
+	fmt.Println("Topology:", params.Topology)
+	fmt.Println("Engine:", params.Engine)
+	fmt.Println("Decomposition:", params.Decomposition)
+	fmt.Println("Format:", params.OutputFormat)
+	if params.Resume != "" {
+		fmt.Println("Resume:", params.Resume)
+	}
+	if params.Input != "" {
+		fmt.Println("Input:", params.Input)
+	}
+	if params.Output != "" {
+		fmt.Println("Output:", params.Output)
+	}
+	if params.Broker != "" {
+		fmt.Println("Broker:", params.Broker)
+	}
+	if len(params.Peers) > 0 {
+		fmt.Println("Peers:", strings.Join(params.Peers, ","))
+	}
+	if len(params.Workers) > 0 {
+		fmt.Println("Workers:", strings.Join(params.Workers, ","))
+	}
 
-	keyPresses := make(chan rune, 10)
-	events := make(chan gol.Event, 1000)
+	if *serve != "" {
+		l, err := net.Listen("unix", *serve)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		fmt.Println("Serving on", *serve)
+		if err := gol.Serve(l, params); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	runEvents := events
+	recorded := make(chan error, 1)
+	if *record != "" {
+		options := gol.RecordOptions{Stride: *recordStride, Scale: *recordScale, MaxFrames: *recordFrames}
+		if options.Format, err = gol.AnimationOfPath(*record); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		if *recordPalette != "" {
+			if options.Palette, err = gol.ParsePalette(*recordPalette); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(2)
+			}
+		}
+		file, err := os.Create(*record)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		// The recorder reads the events of the run and passes them on to the viewer.
+		runEvents = make(chan gol.Event, 1000)
+		go func() {
+			err := gol.Record(file, params, runEvents, events, options)
+			if closeErr := file.Close(); err == nil {
+				err = closeErr
+			}
+			recorded <- err
+		}()
+	} else {
+		recorded <- nil
+	}
+
+	logged := make(chan error, 1)
+	if *eventLog != "" {
+		file, err := os.Create(*eventLog)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		// The log reads the events of the run and passes them on to the recorder or the viewer.
+		next := runEvents
+		runEvents = make(chan gol.Event, 1000)
+		go func() {
+			err := gol.LogEvents(file, params, runEvents, next, *logKeyframes)
+			if closeErr := file.Close(); err == nil {
+				err = closeErr
+			}
+			logged <- err
+		}()
+	} else {
+		logged <- nil
+	}
+
+	streamed := make(chan error, 1)
+	if *jsonLines != "" {
+		options := gol.JSONOptions{Sample: *jsonSample}
+		if *jsonTypes != "" {
+			if options.Types, err = gol.ParseEventTypes(*jsonTypes); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(2)
+			}
+		}
+		var w io.WriteCloser = jsonOut
+		if *jsonLines != "-" {
+			if strings.HasPrefix(*jsonLines, "unix:") {
+				w, err = net.Dial("unix", strings.TrimPrefix(*jsonLines, "unix:"))
+			} else {
+				w, err = os.Create(*jsonLines)
+			}
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+		}
+		// The stream reads the events of the run and passes them on to the log, the recorder or the viewer.
+		next := runEvents
+		runEvents = make(chan gol.Event, 1000)
+		go func() {
+			err := gol.WriteJSONLines(w, runEvents, next, options)
+			if w != jsonOut {
+				if closeErr := w.Close(); err == nil {
+					err = closeErr
+				}
+			}
+			streamed <- err
+		}()
+	} else {
+		streamed <- nil
+	}
 
-	gol.Run(params, events, keyPresses)
-	sdl.Start(params, events, keyPresses)
+	gol.Run(params, runEvents, keyPresses)
+	if *headless {
+		for range events {
+		}
+	} else {
+		sdl.Start(params, events, keyPresses)
+	}
+	for _, done := range []chan error{streamed, logged, recorded} {
+		if err := <-done; err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
 }
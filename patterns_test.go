@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// patternCodec is the reader and writer of a pattern format.
+type patternCodec struct {
+	name      string
+	extension string
+	read      func(io.Reader) (util.Pattern, error)
+	write     func(io.Writer, util.Pattern) error
+}
+
+var patternCodecs = []patternCodec{
+	{"rle", ".rle", util.ReadRle, util.WriteRle},
+	{"cells", ".cells", util.ReadPlaintext, util.WritePlaintext},
+	{"life105", ".lif", util.ReadLife105, util.WriteLife105},
+	{"life106", ".lif", util.ReadLife106, util.WriteLife106},
+}
+
+// readPgmPattern reads a pgm image as a two-state pattern.
+func readPgmPattern(path string) (util.Pattern, []byte) {
+	data, err := ioutil.ReadFile(path)
+	util.Check(err)
+	header, raster, err := util.ParsePgm(data)
+	util.Check(err)
+	pattern := util.Pattern{Width: header.Width, Height: header.Height, Cells: make([]uint8, len(raster))}
+	for i, value := range raster {
+		if value == 255 {
+			pattern.Cells[i] = 1
+		}
+	}
+	return pattern, raster
+}
+
+// TestPatternRoundTrip converts every image in images/ to each pattern format and back,
+// and checks that the image is unchanged.
+func TestPatternRoundTrip(t *testing.T) {
+	paths, err := filepath.Glob("images/*.pgm")
+	util.Check(err)
+	for _, path := range paths {
+		pattern, raster := readPgmPattern(path)
+		for _, codec := range patternCodecs {
+			t.Run(fmt.Sprintf("%v-%v", filepath.Base(path), codec.name), func(t *testing.T) {
+				var b bytes.Buffer
+				util.Check(codec.write(&b, pattern))
+				read, err := codec.read(&b)
+				if err != nil {
+					t.Fatal(err)
+				}
+				// Life 1.06 only records the alive cells, so the pattern is placed back on the board at its origin.
+				back := make([]byte, len(raster))
+				for y := 0; y < read.Height; y++ {
+					for x := 0; x < read.Width; x++ {
+						if read.Get(x, y) == 1 {
+							back[(read.Origin.Y+y)*pattern.Width+read.Origin.X+x] = 255
+						}
+					}
+				}
+				if !bytes.Equal(back, raster) {
+					t.Fatalf("%v changed through the %v format", path, codec.name)
+				}
+			})
+		}
+	}
+}
+
+// TestPatternFormats runs 100 turns from the 64x64 image converted to each pattern format,
+// with and without its file extension, writing the final board in the same format.
+func TestPatternFormats(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gol")
+	util.Check(err)
+	defer os.RemoveAll(dir)
+	pattern, _ := readPgmPattern("images/64x64.pgm")
+	expected := util.ReadAliveCells("check/images/64x64x100.pgm", 64, 64)
+
+	for i, codec := range patternCodecs {
+		for _, extension := range []string{codec.extension, ""} {
+			var b bytes.Buffer
+			util.Check(codec.write(&b, pattern))
+			path := filepath.Join(dir, fmt.Sprintf("%v%v", i, extension))
+			util.Check(ioutil.WriteFile(path, b.Bytes(), 0644))
+			output, err := gol.ParseFormat(codec.name)
+			util.Check(err)
+			p := gol.Params{Turns: 100, Threads: 4, ImageWidth: 64, ImageHeight: 64, Input: path, OutputFormat: output}
+
+			t.Run(codec.name+extension, func(t *testing.T) {
+				outPath := "out/64x64x100" + codec.extension
+				defer os.Remove(outPath)
+				assertEqualBoard(t, runFinal(p).Alive, expected, p)
+
+				file, err := os.Open(outPath)
+				util.Check(err)
+				defer file.Close()
+				written, err := codec.read(file)
+				if err != nil {
+					t.Fatal(err)
+				}
+				var cells []util.Cell
+				for y := 0; y < written.Height; y++ {
+					for x := 0; x < written.Width; x++ {
+						if written.Get(x, y) == 1 {
+							cells = append(cells, util.Cell{X: written.Origin.X + x, Y: written.Origin.Y + y})
+						}
+					}
+				}
+				assertEqualBoard(t, cells, expected, p)
+			})
+		}
+	}
+}
+
+// TestLifeTooLarge checks that cells of a Life 1.05 or 1.06 file spread further apart than a pattern may cover,
+// or too far from the origin to measure, are an error rather than a huge allocation.
+func TestLifeTooLarge(t *testing.T) {
+	tests := []struct {
+		name string
+		read func(io.Reader) (util.Pattern, error)
+		data string
+	}{
+		{"life106", util.ReadLife106, "#Life 1.06\n-2000000000 0\n2000000000 0\n"},
+		{"life106-wide", util.ReadLife106, "#Life 1.06\n0 0\n40000 40000\n"},
+		{"life106-far", util.ReadLife106, "#Life 1.06\n9223372036854775807 0\n"},
+		{"life105", util.ReadLife105, "#Life 1.05\n#P -2000000000 0\n*\n#P 2000000000 0\n*\n"},
+	}
+	for _, test := range tests {
+		if _, err := test.read(strings.NewReader(test.data)); err == nil {
+			t.Errorf("%v: expected an error for cells too far apart", test.name)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// TestHelperWorkerProcess is not a real test. startWorkerProcesses runs the test binary with it to serve a worker process,
+// which prints its address and serves until it is killed.
+func TestHelperWorkerProcess(t *testing.T) {
+	if os.Getenv("GOL_WORKER_PROCESS") != "1" {
+		return
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	util.Check(err)
+	fmt.Println(l.Addr())
+	util.Check(gol.ServeWorker(l))
+}
+
+// startWorkerProcesses starts worker processes on loopback ports and returns their addresses and processes.
+func startWorkerProcesses(n int) ([]string, []*exec.Cmd) {
+	var addresses []string
+	var processes []*exec.Cmd
+	for i := 0; i < n; i++ {
+		cmd := exec.Command(os.Args[0], "-test.run=^TestHelperWorkerProcess$")
+		cmd.Env = append(os.Environ(), "GOL_WORKER_PROCESS=1")
+		stdout, err := cmd.StdoutPipe()
+		util.Check(err)
+		util.Check(cmd.Start())
+		address, err := bufio.NewReader(stdout).ReadString('\n')
+		util.Check(err)
+		addresses = append(addresses, strings.TrimSpace(address))
+		processes = append(processes, cmd)
+	}
+	return addresses, processes
+}
+
+func stopWorkerProcesses(processes []*exec.Cmd) {
+	for _, cmd := range processes {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+	}
+}
+
+// TestPeers runs the TestGol cases, a non-square image and the topologies that peers support on 1, 3 and 4 worker processes,
+// and checks the board built from the flipped cells as well as the final one.
+func TestPeers(t *testing.T) {
+	addresses, processes := startWorkerProcesses(4)
+	defer stopWorkerProcesses(processes)
+
+	type test struct {
+		p    gol.Params
+		path string
+	}
+	var tests []test
+	for _, size := range []int{16, 64, 512} {
+		for _, turns := range []int{0, 1, 100} {
+			tests = append(tests, test{
+				gol.Params{ImageWidth: size, ImageHeight: size, Turns: turns},
+				fmt.Sprintf("check/images/%vx%vx%v.pgm", size, size, turns),
+			})
+		}
+	}
+	tests = append(tests, test{
+		gol.Params{ImageWidth: 500, ImageHeight: 37, Turns: 100},
+		"check/images/500x37x100.pgm",
+	})
+	for _, topology := range []gol.Topology{gol.Plane, gol.HorizontalCylinder, gol.VerticalCylinder} {
+		tests = append(tests, test{
+			gol.Params{ImageWidth: 64, ImageHeight: 64, Turns: 100, Topology: topology},
+			fmt.Sprintf("check/images/topologies/%v/64x64x100.pgm", topology),
+		})
+	}
+
+	for _, test := range tests {
+		p := test.p
+		expectedAlive := util.ReadAliveCells(test.path, p.ImageWidth, p.ImageHeight)
+		for _, peers := range []int{1, 3, 4} {
+			p.Threads = peers
+			p.Peers = addresses[:peers]
+			testName := fmt.Sprintf("%v-%dx%dx%d-%d", p.Topology, p.ImageWidth, p.ImageHeight, p.Turns, peers)
+			t.Run(testName, func(t *testing.T) {
+				events := make(chan gol.Event)
+				gol.Run(p, events, nil)
+				var cells []util.Cell
+				var run []gol.Event
+				for event := range events {
+					run = append(run, event)
+					switch e := event.(type) {
+					case gol.FinalTurnComplete:
+						cells = e.Alive
+					}
+				}
+				assertEqualBoard(t, cells, expectedAlive, p)
+				// A viewer following the flipped cells sees the same board.
+				if p.Turns > 0 {
+					assertEqualBoard(t, boardAt(run, p.Turns-1), expectedAlive, p)
+				}
+			})
+		}
+	}
+}
+
+// TestPeerLost kills one of three peers part of the way through a run and checks that the run ends with a RunFailed event
+// and quits, rather than panicking or waiting forever for the halo rows of the lost peer.
+func TestPeerLost(t *testing.T) {
+	addresses, processes := startWorkerProcesses(3)
+	defer stopWorkerProcesses(processes)
+
+	p := gol.Params{Turns: 1000, Threads: 3, ImageWidth: 64, ImageHeight: 64, Peers: addresses}
+	defer os.Remove("out/64x64x1000.checkpoint.pgm")
+	events := make(chan gol.Event)
+	gol.Run(p, events, nil)
+
+	var failed *gol.RunFailed
+	var last gol.Event
+	for event := range events {
+		switch e := event.(type) {
+		case gol.TurnComplete:
+			if e.CompletedTurns == 10 {
+				util.Check(processes[1].Process.Kill())
+			}
+		case gol.RunFailed:
+			failed = &e
+		}
+		last = event
+	}
+	if failed == nil || failed.CompletedTurns <= 10 || failed.CompletedTurns >= p.Turns {
+		t.Fatalf("Expected the run to fail once the peer was lost, got %v", failed)
+	}
+	if last != (gol.StateChange{CompletedTurns: failed.CompletedTurns, NewState: gol.Quitting}) {
+		t.Errorf("Expected the run to quit at turn %v, the last event was %v", failed.CompletedTurns, last)
+	}
+}
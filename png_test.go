@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// writeTestImage draws the 64x64 image in two colours and writes it to a png or jpeg file in dir.
+func writeTestImage(t *testing.T, dir, name string, dead, alive color.Color) string {
+	m := image.NewRGBA(image.Rect(0, 0, 64, 64))
+	for y := 0; y < 64; y++ {
+		for x := 0; x < 64; x++ {
+			m.Set(x, y, dead)
+		}
+	}
+	for _, cell := range util.ReadAliveCells("images/64x64.pgm", 64, 64) {
+		m.Set(cell.X, cell.Y, alive)
+	}
+	path := filepath.Join(dir, name)
+	file, err := os.Create(path)
+	util.Check(err)
+	defer file.Close()
+	if filepath.Ext(name) == ".jpg" {
+		util.Check(jpeg.Encode(file, m, &jpeg.Options{Quality: 100}))
+	} else {
+		util.Check(png.Encode(file, m))
+	}
+	return path
+}
+
+// TestPng reads the 64x64 image drawn in colours by its luminance and by a palette, and from a jpeg,
+// runs 100 turns and writes the final board as a png scaled up 3 times in a palette.
+func TestPng(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gol")
+	util.Check(err)
+	defer os.RemoveAll(dir)
+	navy, yellow := color.RGBA{B: 128, A: 255}, color.RGBA{R: 255, G: 255, A: 255}
+	palette := color.Palette{navy, yellow}
+	expected := util.ReadAliveCells("check/images/64x64x100.pgm", 64, 64)
+
+	tests := []struct {
+		name string
+		p    gol.Params
+	}{
+		{"threshold", gol.Params{Input: writeTestImage(t, dir, "threshold.png", navy, yellow)}},
+		{"palette", gol.Params{Input: writeTestImage(t, dir, "palette.png", color.White, color.Black), Palette: color.Palette{color.White, color.Black}}},
+		{"jpeg", gol.Params{Input: writeTestImage(t, dir, "start.jpg", color.Black, color.White), Threshold: 100}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p := test.p
+			p.Turns, p.Threads = 100, 4
+			assertEqualBoard(t, runFinal(p).Alive, expected, gol.Params{ImageWidth: 64, ImageHeight: 64})
+		})
+	}
+
+	t.Run("output", func(t *testing.T) {
+		output := filepath.Join(dir, "final.png")
+		p := gol.Params{Turns: 100, Threads: 4, Input: "images/64x64.pgm", Output: output, OutputFormat: gol.PNG, Palette: palette, Scale: 3}
+		runFinal(p)
+
+		file, err := os.Open(output)
+		util.Check(err)
+		defer file.Close()
+		m, err := png.Decode(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m.Bounds().Dx() != 192 || m.Bounds().Dy() != 192 {
+			t.Fatalf("Expected a 192x192 image, got %v", m.Bounds())
+		}
+		var cells []util.Cell
+		for y := 0; y < 64; y++ {
+			for x := 0; x < 64; x++ {
+				if r, g, b, _ := m.At(3*x+2, 3*y+1).RGBA(); r == 0xffff && g == 0xffff && b == 0 {
+					cells = append(cells, util.Cell{X: x, Y: y})
+				}
+			}
+		}
+		assertEqualBoard(t, cells, expected, gol.Params{ImageWidth: 64, ImageHeight: 64})
+	})
+
+	t.Run("grey", func(t *testing.T) {
+		output := filepath.Join(dir, "grey.png")
+		p := gol.Params{Turns: 100, Threads: 4, Input: "images/64x64.pgm", Output: output, OutputFormat: gol.PNG, Scale: 2}
+		runFinal(p)
+		assertEqualBoard(t, util.ReadAliveCells(output, 64, 64), expected, gol.Params{ImageWidth: 64, ImageHeight: 64})
+	})
+
+	t.Run("rejected", func(t *testing.T) {
+		// A palette with more colours than the rule has states.
+		bad := writeTestImage(t, dir, "states.png", color.White, navy)
+		if _, err := gol.ReadInput(gol.Params{Input: bad, Palette: color.Palette{color.White, color.Black, navy}}); err == nil {
+			t.Error("Expected an error for a pixel in a colour beyond the states of the rule")
+		}
+
+		// A header claiming a 65536x65536 image, rejected before its pixels are decoded.
+		var b bytes.Buffer
+		util.Check(png.Encode(&b, image.NewGray(image.Rect(0, 0, 1, 1))))
+		data := b.Bytes()
+		binary.BigEndian.PutUint32(data[16:], 1<<16)
+		binary.BigEndian.PutUint32(data[20:], 1<<16)
+		binary.BigEndian.PutUint32(data[29:], crc32.ChecksumIEEE(data[12:29]))
+		large := filepath.Join(dir, "large.png")
+		util.Check(ioutil.WriteFile(large, data, 0644))
+		if _, err := gol.ReadInput(gol.Params{Input: large}); err == nil || !strings.Contains(err.Error(), "too large") {
+			t.Errorf("Expected a 65536x65536 image to be too large, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,47 @@
+//go:build go1.18
+// +build go1.18
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// FuzzReadPgm checks that ReadPgm returns an error rather than panicking on any input,
+// and that every image it accepts is written and read back unchanged as a binary pgm.
+// Run it with go test -fuzz FuzzReadPgm.
+func FuzzReadPgm(f *testing.F) {
+	image, err := ioutil.ReadFile("images/16x16.pgm")
+	util.Check(err)
+	f.Add(image)
+	f.Add([]byte("P1\n# a glider\n3 3\n010\n001\n111\n"))
+	f.Add([]byte("P2\n2 2\n65535\n0 1\n32768 65535\n"))
+	f.Add([]byte("P4\n# origin -1 2\n9 2\n\xff\x80\x00\x00"))
+	f.Add([]byte("P5 2 1 65535\n\x00\x01\xff\xff"))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		header, pixels, err := util.ReadPgm(bytes.NewReader(data))
+		if err != nil {
+			return
+		}
+		if len(pixels) != header.Width*header.Height {
+			t.Fatalf("%v pixels for a %vx%v image", len(pixels), header.Width, header.Height)
+		}
+		var b bytes.Buffer
+		header.Magic = "P5"
+		if err := util.WritePgm(&b, header, pixels); err != nil {
+			t.Fatal(err)
+		}
+		read, back, err := util.ReadPgm(&b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if read.Width != header.Width || read.Height != header.Height || read.Origin != header.Origin || !bytes.Equal(back, pixels) {
+			t.Fatalf("Expected %+v %v back, got %+v %v", header, pixels, read, back)
+		}
+	})
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// TestPgmCodec reads every pbm and pgm format, with comments, whitespace pixels and 16-bit maxvals,
+// and checks that malformed files are rejected with an error.
+func TestPgmCodec(t *testing.T) {
+	tests := []struct {
+		name   string
+		data   string
+		width  int
+		pixels []byte
+	}{
+		{"P1", "P1\n# a glider\n3 2\n0 1 0\n0 0 1\n", 3, []byte{0, 255, 0, 0, 0, 255}},
+		{"P1 packed digits", "P1 3 2 010001", 3, []byte{0, 255, 0, 0, 0, 255}},
+		{"P2", "P2\n2 2 # size\n4\n0 1\n2 4\n", 2, []byte{0, 64, 128, 255}},
+		{"P4", "P4\n10 1\n\x80\x40", 10, []byte{255, 0, 0, 0, 0, 0, 0, 0, 0, 255}},
+		{"P5 whitespace pixels", "P5\n4 1\n255\n\x09\x0a\x20\xff", 4, []byte{9, 10, 32, 255}},
+		{"P5 comments", "P5 # first\n# second\n2 1 255\n\x00\xff", 2, []byte{0, 255}},
+		{"P5 16-bit", "P5 3 1 65535\n\x00\x00\x80\x00\xff\xfe", 3, []byte{0, 128, 255}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			header, pixels, err := util.ReadPgm(strings.NewReader(test.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if header.Width != test.width || !bytes.Equal(pixels, test.pixels) {
+				t.Fatalf("Expected %v pixels %v, got %v pixels %v", test.width, test.pixels, header.Width, pixels)
+			}
+		})
+	}
+
+	for _, data := range []string{
+		"",
+		"P6\n1 1\n255\n\x00",
+		"P5\n2 2\n255\n\x00",
+		"P5\n2 x\n255\n\x00\x00",
+		"P5\n1 1\n0\n\x00",
+		"P5\n1 1\n70000\n\x00\x00",
+		"P2\n1 1\n4\n5\n",
+		"P1\n2 1\n0 2\n",
+		"P4\n9 1\n\x00",
+		"P5\n1000000 1000000\n255\n",
+	} {
+		if _, _, err := util.ReadPgm(strings.NewReader(data)); err == nil {
+			t.Errorf("Expected an error reading %q", data)
+		}
+	}
+}
+
+// TestPgmRoundTrip writes an image with an origin and comments in every pbm and pgm format and reads it back.
+func TestPgmRoundTrip(t *testing.T) {
+	pixels := []byte{0, 255, 0, 255, 255, 0, 0, 0, 255, 255, 0, 255}
+	for _, magic := range []string{"P1", "P2", "P4", "P5"} {
+		t.Run(magic, func(t *testing.T) {
+			header := util.PgmHeader{Magic: magic, Width: 4, Height: 3, Comments: []string{"turn 7"}}
+			header.Origin.X, header.Origin.Y = -2, 5
+			var b bytes.Buffer
+			util.Check(util.WritePgm(&b, header, pixels))
+			read, back, err := util.ReadPgm(&b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if read.Magic != magic || read.Width != 4 || read.Height != 3 || read.Origin != header.Origin ||
+				len(read.Comments) != 1 || read.Comments[0] != "turn 7" {
+				t.Fatalf("Expected the header %+v, got %+v", header, read)
+			}
+			if !bytes.Equal(back, pixels) {
+				t.Fatalf("Expected the pixels %v, got %v", pixels, back)
+			}
+		})
+	}
+}
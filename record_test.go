@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"testing"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// recordRun records 100 turns of the 64x64 image, forwarding the events to a consumer that waits for the final turn.
+func recordRun(t *testing.T, o gol.RecordOptions) []byte {
+	p := gol.Params{Turns: 100, Threads: 4, ImageWidth: 64, ImageHeight: 64}
+	events := make(chan gol.Event)
+	forwarded := make(chan gol.Event)
+	var b bytes.Buffer
+	recorded := make(chan error)
+	go func() { recorded <- gol.Record(&b, p, events, forwarded, o) }()
+	gol.Run(p, events, nil)
+	final := false
+	for event := range forwarded {
+		if _, ok := event.(gol.FinalTurnComplete); ok {
+			final = true
+		}
+	}
+	if !final {
+		t.Fatal("Expected the events to be forwarded")
+	}
+	if err := <-recorded; err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+// frameCells returns the cells of a frame drawn in colour, reading one pixel per cell of the given scale.
+func frameCells(m image.Image, scale int, alive color.Color) []util.Cell {
+	var cells []util.Cell
+	r, g, b, _ := alive.RGBA()
+	for y := 0; y < m.Bounds().Dy()/scale; y++ {
+		for x := 0; x < m.Bounds().Dx()/scale; x++ {
+			if cr, cg, cb, _ := m.At(x*scale+scale-1, y*scale+scale-1).RGBA(); cr == r && cg == g && cb == b {
+				cells = append(cells, util.Cell{X: x, Y: y})
+			}
+		}
+	}
+	return cells
+}
+
+// TestRecordGif records an animated GIF with a frame every 10 turns and a palette, and checks the first and last frames.
+func TestRecordGif(t *testing.T) {
+	palette, err := gol.ParsePalette("#102030,#f0e0d0")
+	util.Check(err)
+	data := recordRun(t, gol.RecordOptions{Format: gol.GIF, Stride: 10, Scale: 2, Palette: palette})
+	animation, err := gif.DecodeAll(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Frames are taken after turns 1, 11, ..., 91, followed by the final board after turn 100.
+	if len(animation.Image) != 11 {
+		t.Fatalf("Expected 11 frames, got %v", len(animation.Image))
+	}
+	p := gol.Params{ImageWidth: 64, ImageHeight: 64}
+	assertEqualBoard(t, frameCells(animation.Image[0], 2, palette[1]), util.ReadAliveCells("check/images/64x64x1.pgm", 64, 64), p)
+	assertEqualBoard(t, frameCells(animation.Image[10], 2, palette[1]), util.ReadAliveCells("check/images/64x64x100.pgm", 64, 64), p)
+}
+
+// TestRecordApng records an animated PNG of at most 5 frames and checks its chunks and its default image.
+func TestRecordApng(t *testing.T) {
+	data := recordRun(t, gol.RecordOptions{Format: gol.APNG, Stride: 1, MaxFrames: 5})
+	m, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := gol.Params{ImageWidth: 64, ImageHeight: 64}
+	assertEqualBoard(t, frameCells(m, 1, color.White), util.ReadAliveCells("check/images/64x64x1.pgm", 64, 64), p)
+
+	counts := make(map[string]int)
+	frames := -1
+	for rest := data[8:]; len(rest) >= 12; {
+		length := binary.BigEndian.Uint32(rest)
+		kind := string(rest[4:8])
+		counts[kind]++
+		if kind == "acTL" {
+			frames = int(binary.BigEndian.Uint32(rest[8:]))
+		}
+		rest = rest[12+length:]
+	}
+	if frames != 5 || counts["fcTL"] != 5 || counts["fdAT"] < 4 || counts["IEND"] != 1 {
+		t.Fatalf("Expected an animation of 5 frames, got %v frames and the chunks %v", frames, counts)
+	}
+}
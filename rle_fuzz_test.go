@@ -0,0 +1,45 @@
+//go:build go1.18
+// +build go1.18
+
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// FuzzReadRle checks that ReadRle returns an error rather than panicking on any input,
+// and that the cells of every pattern it accepts are written and read back unchanged.
+// Run it with go test -fuzz FuzzReadRle.
+func FuzzReadRle(f *testing.F) {
+	f.Add([]byte("#N Glider\n#C The smallest spaceship.\nx = 3, y = 3, rule = B3/S23\nbo$2bo$3o!\n"))
+	f.Add([]byte("#CXRLE Pos=-1,2\nx = 4, y = 2, rule = B2/S345/C60:T64,64\n.A2B$pAyO!\n"))
+	f.Add([]byte("x = 3, y = 3\no99999999999999999999o!\n"))
+	f.Add([]byte("x = 3, y = 3\no9223372036854775807o!\n"))
+	f.Add([]byte("x = 3, y = 3\no9223372036854775807$o!\n"))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		pattern, err := util.ReadRle(bytes.NewReader(data))
+		if err != nil {
+			return
+		}
+		if len(pattern.Cells) != pattern.Width*pattern.Height {
+			t.Fatalf("%v cells for a %vx%v pattern", len(pattern.Cells), pattern.Width, pattern.Height)
+		}
+		// Only the cells are compared, as the rule, name and comments are written back as they were read.
+		pattern.Rule, pattern.Name, pattern.Comments = "", "", nil
+		var b bytes.Buffer
+		if err := util.WriteRle(&b, pattern); err != nil {
+			t.Fatal(err)
+		}
+		read, err := util.ReadRle(&b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if read.Width != pattern.Width || read.Height != pattern.Height || read.Origin != pattern.Origin || !bytes.Equal(read.Cells, pattern.Cells) {
+			t.Fatalf("Expected %+v back, got %+v", pattern, read)
+		}
+	})
+}
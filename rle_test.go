@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// writeTestRle writes an RLE file into dir and returns its path.
+func writeTestRle(t *testing.T, dir, name, rle string) string {
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, []byte(rle), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// runFinal runs p and returns its FinalTurnComplete event.
+func runFinal(p gol.Params) gol.FinalTurnComplete {
+	events := make(chan gol.Event)
+	gol.Run(p, events, nil)
+	var final gol.FinalTurnComplete
+	for event := range events {
+		if e, ok := event.(gol.FinalTurnComplete); ok {
+			final = e
+		}
+	}
+	return final
+}
+
+// TestRle converts the 64x64 and 512x512 images to RLE, runs 100 turns from them with RLE output
+// and checks the output against the expected images.
+func TestRle(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gol")
+	util.Check(err)
+	defer os.RemoveAll(dir)
+
+	for _, size := range []int{64, 512} {
+		pattern := util.Pattern{Width: size, Height: size, Cells: make([]uint8, size*size), Rule: "B3/S23"}
+		for _, cell := range util.ReadAliveCells(fmt.Sprintf("images/%vx%v.pgm", size, size), size, size) {
+			pattern.Cells[cell.Y*size+cell.X] = 1
+		}
+		var b bytes.Buffer
+		util.Check(util.WriteRle(&b, pattern))
+		path := writeTestRle(t, dir, fmt.Sprintf("%v.rle", size), b.String())
+
+		p := gol.Params{Turns: 100, Threads: 8, ImageWidth: size, ImageHeight: size, Input: path, OutputFormat: gol.RLE}
+		output := fmt.Sprintf("out/%vx%vx100.rle", size, size)
+		t.Run(fmt.Sprintf("%dx%d", size, size), func(t *testing.T) {
+			defer os.Remove(output)
+			final := runFinal(p)
+			expected := util.ReadAliveCells(fmt.Sprintf("check/images/%vx%vx100.pgm", size, size), size, size)
+			assertEqualBoard(t, final.Alive, expected, p)
+
+			data, err := ioutil.ReadFile(output)
+			util.Check(err)
+			for i, line := range strings.Split(string(data), "\n") {
+				if len(line) > 70 {
+					t.Fatalf("Expected lines of at most 70 characters, line %v has %v", i+1, len(line))
+				}
+			}
+			written, err := util.ReadRle(bytes.NewReader(data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if expectedRule := fmt.Sprintf("B3/S23:T%v,%v", size, size); written.Rule != expectedRule {
+				t.Errorf("Expected the rule %v, got %v", expectedRule, written.Rule)
+			}
+			var cells []util.Cell
+			for y := 0; y < written.Height; y++ {
+				for x := 0; x < written.Width; x++ {
+					if written.Get(x, y) == 1 {
+						cells = append(cells, util.Cell{X: x, Y: y})
+					}
+				}
+			}
+			assertEqualBoard(t, cells, expected, p)
+		})
+	}
+}
+
+// TestRlePlacement places a glider in the centre of a board and at an offset,
+// and checks that the rule in the header of a pattern is used.
+func TestRlePlacement(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gol")
+	util.Check(err)
+	defer os.RemoveAll(dir)
+	glider := writeTestRle(t, dir, "glider.rle", "#N Glider\n#C The smallest spaceship.\nx = 3, y = 3, rule = B3/S23\nbo$2bo$3o!\n")
+	domino := writeTestRle(t, dir, "domino.rle", "x = 2, y = 1, rule = B2/S\n2o!\n")
+
+	offset := image.Pt(1, 2)
+	tests := []struct {
+		name     string
+		p        gol.Params
+		expected []util.Cell
+	}{
+		{
+			"centred",
+			gol.Params{ImageWidth: 16, ImageHeight: 16, Input: glider},
+			[]util.Cell{{X: 7, Y: 6}, {X: 8, Y: 7}, {X: 6, Y: 8}, {X: 7, Y: 8}, {X: 8, Y: 8}},
+		},
+		{
+			"offset",
+			gol.Params{ImageWidth: 16, ImageHeight: 16, Input: glider, InputOffset: &offset},
+			[]util.Cell{{X: 2, Y: 2}, {X: 3, Y: 3}, {X: 1, Y: 4}, {X: 2, Y: 4}, {X: 3, Y: 4}},
+		},
+		{
+			"rule",
+			gol.Params{ImageWidth: 8, ImageHeight: 8, Turns: 1, Input: domino},
+			[]util.Cell{{X: 3, Y: 2}, {X: 4, Y: 2}, {X: 3, Y: 4}, {X: 4, Y: 4}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.p.Threads = 1
+			assertEqualBoard(t, runFinal(test.p).Alive, test.expected, test.p)
+		})
+	}
+}
+
+// TestRleRoundTrip writes and reads back a pattern with a name, comments, an origin and Generations states.
+func TestRleRoundTrip(t *testing.T) {
+	pattern := util.Pattern{
+		Width:      60,
+		Height:     7,
+		Cells:      make([]uint8, 60*7),
+		Rule:       "B2/S345/C60",
+		Name:       "States",
+		Comments:   []string{"Every state", "of a Generations rule"},
+		Origin:     image.Pt(-3, 5),
+		Positioned: true,
+	}
+	for i := range pattern.Cells {
+		if i%7 != 0 {
+			pattern.Cells[i] = uint8(i % 60)
+		}
+	}
+	var b bytes.Buffer
+	util.Check(util.WriteRle(&b, pattern))
+	read, err := util.ReadRle(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if read.Width != pattern.Width || read.Height != pattern.Height || read.Rule != pattern.Rule ||
+		read.Name != pattern.Name || read.Origin != pattern.Origin || !read.Positioned || strings.Join(read.Comments, "\n") != strings.Join(pattern.Comments, "\n") {
+		t.Fatalf("Expected the header of %+v, got %+v", pattern, read)
+	}
+	if !bytes.Equal(read.Cells, pattern.Cells) {
+		t.Fatalf("Expected the cells %v, got %v", pattern.Cells, read.Cells)
+	}
+}
+
+// TestRleTooLarge checks that a header declaring more cells than can be held is an error rather than a panic.
+func TestRleTooLarge(t *testing.T) {
+	for _, header := range []string{"x = 3000000000, y = 3000000000", "x = 2000000000, y = 1", "x = 40000, y = 40000"} {
+		if _, err := util.ReadRle(strings.NewReader(header + "\n!\n")); err == nil || !strings.Contains(err.Error(), "too large") {
+			t.Errorf("Expected %q to be too large, got %v", header, err)
+		}
+	}
+}
+
+// TestRleRuns checks that run counts which are not numbers, or do not fit in the pattern, are errors rather than panics.
+func TestRleRuns(t *testing.T) {
+	for _, cells := range []string{"o99999999999999999999o!", "o9223372036854775807o!", "4o!", "0o!", "o9223372036854775807$o!", "3$o!"} {
+		if _, err := util.ReadRle(strings.NewReader("x = 3, y = 3\n" + cells + "\n")); err == nil {
+			t.Errorf("Expected an error reading the cells %q of a 3x3 pattern", cells)
+		}
+	}
+	if _, err := util.ReadRle(strings.NewReader("x = 3, y = 3\nbo$2bo$3o$!\n")); err != nil {
+		t.Errorf("Expected a $ after the last row to be accepted, got %v", err)
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// TestRules tests HighLife, Day & Night and Seeds on 16x16 and 64x64 images on 1 and 100 turns using 1, 4 and 8 worker threads.
+func TestRules(t *testing.T) {
+	rules := []string{"B36/S23", "B3678/S34678", "B2/S"}
+	tests := []gol.Params{
+		{ImageWidth: 16, ImageHeight: 16},
+		{ImageWidth: 64, ImageHeight: 64},
+	}
+	for _, ruleString := range rules {
+		rule, err := gol.ParseRule(ruleString)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, p := range tests {
+			p.Rule = rule
+			for _, turns := range []int{1, 100} {
+				p.Turns = turns
+				expectedAlive := util.ReadAliveCells(
+					"check/images/rules/"+strings.Replace(ruleString, "/", "", 1)+fmt.Sprintf("/%vx%vx%v.pgm", p.ImageWidth, p.ImageHeight, turns),
+					p.ImageWidth,
+					p.ImageHeight,
+				)
+				for _, threads := range []int{1, 4, 8} {
+					p.Threads = threads
+					testName := fmt.Sprintf("%v-%dx%dx%d-%d", rule, p.ImageWidth, p.ImageHeight, p.Turns, p.Threads)
+					t.Run(testName, func(t *testing.T) {
+						events := make(chan gol.Event)
+						gol.Run(p, events, nil)
+						var cells []util.Cell
+						for event := range events {
+							switch e := event.(type) {
+							case gol.FinalTurnComplete:
+								cells = e.Alive
+							}
+						}
+						assertEqualBoard(t, cells, expectedAlive, p)
+					})
+				}
+			}
+		}
+	}
+}
+
+// TestParseRule checks that equivalent rulestrings in different notations parse to the same rule.
+func TestParseRule(t *testing.T) {
+	tests := []struct {
+		rulestrings []string
+		canonical   string
+	}{
+		{[]string{"B3/S23", "b3s23", "23/3", "S23/B3"}, "B3/S23"},
+		{[]string{"B36/S23", "b36/s23", "23/36"}, "B36/S23"},
+		{[]string{"B3678/S34678", "34678/3678"}, "B3678/S34678"},
+		{[]string{"B2/S", "b2s", "/2"}, "B2/S"},
+	}
+	for _, test := range tests {
+		for _, rs := range test.rulestrings {
+			rule, err := gol.ParseRule(rs)
+			if err != nil {
+				t.Errorf("%q: %v", rs, err)
+				continue
+			}
+			if rule.String() != test.canonical {
+				t.Errorf("%q parsed as %v, expected %v", rs, rule, test.canonical)
+			}
+		}
+	}
+	for _, rs := range []string{"", "B9/S23", "B3/X23", "23", "B/S"} {
+		if _, err := gol.ParseRule(rs); err == nil {
+			t.Errorf("%q: expected an error", rs)
+		}
+	}
+}
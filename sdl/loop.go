@@ -35,7 +35,16 @@ sdlLoop:
 			}
 			switch e := event.(type) {
 			case gol.CellFlipped:
-				w.FlipPixel(e.Cell.X, e.Cell.Y)
+				// On an unbounded plane cells may be outside of the window.
+				if e.Cell.X >= 0 && e.Cell.X < p.ImageWidth && e.Cell.Y >= 0 && e.Cell.Y < p.ImageHeight {
+					w.SetPixelValue(e.Cell.X, e.Cell.Y, e.Value)
+				}
+			case gol.TurnDiff:
+				for i, cell := range e.Cells {
+					if cell.X >= 0 && cell.X < p.ImageWidth && cell.Y >= 0 && cell.Y < p.ImageHeight {
+						w.SetPixelValue(cell.X, cell.Y, e.Values[i])
+					}
+				}
 			case gol.TurnComplete:
 				w.RenderFrame()
 			default:
@@ -73,6 +73,15 @@ func (w *Window) SetPixel(x, y int) {
 	w.pixels[4*(y*width+x)+3] = 0xFF
 }
 
+// SetPixelValue sets the pixel to a grey level, so dying cells of Generations rules are drawn as a gradient.
+func (w *Window) SetPixelValue(x, y int, value uint8) {
+	width := int(w.Width)
+	w.pixels[4*(y*width+x)+0] = value
+	w.pixels[4*(y*width+x)+1] = value
+	w.pixels[4*(y*width+x)+2] = value
+	w.pixels[4*(y*width+x)+3] = 0xFF
+}
+
 func (w *Window) FlipPixel(x, y int) {
 	width := int(w.Width)
 	w.pixels[4*(y*width+x)+0] = ^w.pixels[4*(y*width+x)+0]
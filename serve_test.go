@@ -0,0 +1,145 @@
+package main
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// TestServe detaches a viewer from a headless simulation with 'q', checks that the simulation kept running
+// when a second viewer attaches, and shuts it down with 'k'. The board of the second viewer, built from the board
+// it was sent and the flipped cells that followed, must match the final PGM.
+func TestServe(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gol")
+	util.Check(err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "gol.sock")
+	l, err := net.Listen("unix", path)
+	util.Check(err)
+
+	p := gol.Params{
+		Turns:       100000000,
+		Threads:     8,
+		ImageWidth:  512,
+		ImageHeight: 512,
+	}
+	defer os.Remove("out/512x512x100000000.checkpoint.pgm")
+	served := make(chan error)
+	go func() { served <- gol.Serve(l, p) }()
+
+	events := make(chan gol.Event)
+	keyPresses := make(chan rune)
+	params, err := gol.Attach(path, events, keyPresses)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if params.ImageWidth != 512 || params.ImageHeight != 512 {
+		t.Fatalf("Expected a 512x512 board, got %vx%v", params.ImageWidth, params.ImageHeight)
+	}
+	detachedAt := -1
+	for event := range events {
+		switch e := event.(type) {
+		case gol.StateChange:
+			t.Fatalf("Expected the simulation to keep running, got %v", e)
+		case gol.TurnComplete:
+			if detachedAt < 0 && e.CompletedTurns >= 10 {
+				detachedAt = e.CompletedTurns
+				keyPresses <- 'q'
+			}
+		}
+	}
+
+	events = make(chan gol.Event)
+	keyPresses = make(chan rune)
+	_, err = gol.Attach(path, events, keyPresses)
+	if err != nil {
+		t.Fatal(err)
+	}
+	board := make(map[util.Cell]bool)
+	attachedAt := -1
+	var last, output string
+	for event := range events {
+		switch e := event.(type) {
+		case gol.CellFlipped:
+			board[e.Cell] = e.Value == 255
+		case gol.TurnDiff:
+			for i, cell := range e.Cells {
+				board[cell] = e.Values[i] == 255
+			}
+		case gol.TurnComplete:
+			if attachedAt < 0 {
+				attachedAt = e.CompletedTurns
+				keyPresses <- 'k'
+			}
+		case gol.ImageOutputComplete:
+			last = "Output"
+			output = "out/" + e.Filename + ".pgm"
+			defer os.Remove(output)
+		case gol.StateChange:
+			last = e.NewState.String()
+		}
+	}
+	if attachedAt <= detachedAt {
+		t.Fatalf("Expected the simulation to run while detached, detached at turn %v and reattached at turn %v", detachedAt, attachedAt)
+	}
+	if last != "Quitting" {
+		t.Fatalf("Expected the simulation to quit, the last state was %v", last)
+	}
+	if err := <-served; err != nil {
+		t.Fatal(err)
+	}
+
+	var aliveCells []util.Cell
+	for cell, isAlive := range board {
+		if isAlive {
+			aliveCells = append(aliveCells, cell)
+		}
+	}
+	assertEqualBoard(t, aliveCells, util.ReadAliveCells(output, 512, 512), p)
+}
+
+// TestServeB0Unbounded checks that Serve returns an error for a B0 rule on an unbounded plane rather than starting it.
+func TestServeB0Unbounded(t *testing.T) {
+	rule, err := gol.ParseRule("B0/S8")
+	util.Check(err)
+	l, err := net.Listen("tcp", "localhost:0")
+	util.Check(err)
+	defer l.Close()
+	p := gol.Params{Turns: 1, Threads: 1, ImageWidth: 16, ImageHeight: 16, Rule: rule, Topology: gol.Unbounded}
+	if err := gol.Serve(l, p); err == nil {
+		t.Fatal("Expected an error for a B0 rule on an unbounded plane")
+	}
+}
+
+// TestServeSlowViewer attaches a viewer that never reads and checks that the simulation still runs to the end.
+func TestServeSlowViewer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gol")
+	util.Check(err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "gol.sock")
+	l, err := net.Listen("unix", path)
+	util.Check(err)
+
+	p := gol.Params{Turns: 200, Threads: 4, ImageWidth: 512, ImageHeight: 512}
+	defer os.Remove("out/512x512x200.pgm")
+	served := make(chan error)
+	go func() { served <- gol.Serve(l, p) }()
+	conn, err := net.Dial("unix", path)
+	util.Check(err)
+	defer conn.Close()
+
+	select {
+	case err := <-served:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(30 * time.Second):
+		t.Fatal("Expected the simulation to finish while a viewer is not reading its events")
+	}
+}
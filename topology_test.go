@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// TestTopologies tests every non-toroidal topology on 16x16 and 64x64 images on 1 and 100 turns using 1, 3 and 8 worker threads.
+func TestTopologies(t *testing.T) {
+	topologies := []gol.Topology{
+		gol.Plane,
+		gol.HorizontalCylinder,
+		gol.VerticalCylinder,
+		gol.KleinBottle,
+		gol.KleinBottleTwistedSides,
+		gol.CrossSurface,
+		gol.Sphere,
+	}
+	tests := []gol.Params{
+		{ImageWidth: 16, ImageHeight: 16},
+		{ImageWidth: 64, ImageHeight: 64},
+	}
+	for _, topology := range topologies {
+		for _, p := range tests {
+			p.Topology = topology
+			for _, turns := range []int{1, 100} {
+				p.Turns = turns
+				expectedAlive := util.ReadAliveCells(
+					"check/images/topologies/"+fmt.Sprintf("%v/%vx%vx%v.pgm", topology, p.ImageWidth, p.ImageHeight, turns),
+					p.ImageWidth,
+					p.ImageHeight,
+				)
+				for _, threads := range []int{1, 3, 8} {
+					p.Threads = threads
+					testName := fmt.Sprintf("%v-%dx%dx%d-%d", topology, p.ImageWidth, p.ImageHeight, p.Turns, p.Threads)
+					t.Run(testName, func(t *testing.T) {
+						events := make(chan gol.Event)
+						gol.Run(p, events, nil)
+						var cells []util.Cell
+						for event := range events {
+							switch e := event.(type) {
+							case gol.FinalTurnComplete:
+								cells = e.Alive
+							}
+						}
+						assertEqualBoard(t, cells, expectedAlive, p)
+					})
+				}
+			}
+		}
+	}
+}
+
+// TestParseTopology checks Golly's topology notation.
+func TestParseTopology(t *testing.T) {
+	tests := map[string]gol.Topology{
+		"T":                 gol.Torus,
+		"T64,64":            gol.Torus,
+		":P64,64":           gol.Plane,
+		"P":                 gol.Plane,
+		"T64,0":             gol.HorizontalCylinder,
+		"T0,64":             gol.VerticalCylinder,
+		"K":                 gol.KleinBottle,
+		"K64*,64":           gol.KleinBottle,
+		"K64,64*":           gol.KleinBottleTwistedSides,
+		"C64,64":            gol.CrossSurface,
+		"S":                 gol.Sphere,
+		"T0,0":              gol.Unbounded,
+		"klein-bottle":      gol.KleinBottle,
+		"vertical-cylinder": gol.VerticalCylinder,
+	}
+	for s, expected := range tests {
+		topology, err := gol.ParseTopology(s, 64, 64)
+		if err != nil {
+			t.Errorf("%q: %v", s, err)
+		} else if topology != expected {
+			t.Errorf("%q parsed as %v, expected %v", s, topology, expected)
+		}
+	}
+	for _, s := range []string{"", "X", "T32,32", "K64,64", "K64*,64*", "P64*,64", "T64+2,64"} {
+		if _, err := gol.ParseTopology(s, 64, 64); err == nil {
+			t.Errorf("%q: expected an error", s)
+		}
+	}
+	if _, err := gol.ParseTopology("S", 64, 32); err == nil {
+		t.Error("a sphere on a 64x32 board should be rejected")
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// flipsByTurn runs p and returns the cells flipped before each TurnComplete event with their last value,
+// counting the CellFlipped and TurnDiff events sent.
+func flipsByTurn(p gol.Params) (turns []map[util.Cell]uint8, cellEvents, diffs int) {
+	events := make(chan gol.Event)
+	gol.Run(p, events, nil)
+	flipped := make(map[util.Cell]uint8)
+	for event := range events {
+		switch e := event.(type) {
+		case gol.CellFlipped:
+			cellEvents++
+			flipped[e.Cell] = e.Value
+		case gol.TurnDiff:
+			diffs++
+			for i, cell := range e.Cells {
+				flipped[cell] = e.Values[i]
+			}
+		case gol.TurnComplete:
+			turns = append(turns, flipped)
+			flipped = make(map[util.Cell]uint8)
+		}
+	}
+	return turns, cellEvents, diffs
+}
+
+// TestTurnDiff checks that every engine sends the same cells in TurnDiff events as in CellFlipped events
+// with Params.CellEvents, at most one TurnDiff per turn besides the initial board.
+func TestTurnDiff(t *testing.T) {
+	tests := []gol.Params{
+		{Engine: gol.Cells},
+		{Engine: gol.BitPacked},
+		{Engine: gol.HashLife},
+		{Engine: gol.Cells, Topology: gol.Unbounded},
+	}
+	for _, p := range tests {
+		p.Turns, p.Threads, p.ImageWidth, p.ImageHeight = 100, 4, 64, 64
+		t.Run(fmt.Sprintf("%v-%v", p.Engine, p.Topology), func(t *testing.T) {
+			diffTurns, cellEvents, diffs := flipsByTurn(p)
+			if cellEvents != 0 || diffs > len(diffTurns)+1 {
+				t.Errorf("Expected at most %v TurnDiff events and no CellFlipped events, got %v and %v", len(diffTurns)+1, diffs, cellEvents)
+			}
+			p.CellEvents = true
+			cellTurns, cellEvents, diffs := flipsByTurn(p)
+			if diffs != 0 || cellEvents == 0 {
+				t.Errorf("Expected CellFlipped events and no TurnDiff events with CellEvents, got %v and %v", cellEvents, diffs)
+			}
+			if len(diffTurns) != 100 || !reflect.DeepEqual(diffTurns, cellTurns) {
+				t.Errorf("Expected the same cells flipped in each of the 100 turns, got %v and %v turns", len(diffTurns), len(cellTurns))
+			}
+		})
+	}
+}
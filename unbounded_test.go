@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"strconv"
+	"testing"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// TestUnbounded tests 16x16 and 64x64 images on an unbounded plane, where patterns grow past the edges of the image,
+// using 1 and 4 worker threads. The pgm output is cropped to the live cells and must record where they are.
+func TestUnbounded(t *testing.T) {
+	tests := []gol.Params{
+		{ImageWidth: 16, ImageHeight: 16, Turns: 100},
+		{ImageWidth: 64, ImageHeight: 64, Turns: 100},
+		{ImageWidth: 64, ImageHeight: 64, Turns: 1000},
+	}
+	for _, p := range tests {
+		p.Topology = gol.Unbounded
+		expectedAlive := readCellsCsv(fmt.Sprintf("check/unbounded/%vx%vx%v.csv", p.ImageWidth, p.ImageHeight, p.Turns))
+		for _, threads := range []int{1, 4} {
+			p.Threads = threads
+			testName := fmt.Sprintf("%dx%dx%d-%d", p.ImageWidth, p.ImageHeight, p.Turns, p.Threads)
+			t.Run(testName, func(t *testing.T) {
+				events := make(chan gol.Event)
+				gol.Run(p, events, nil)
+				var cells []util.Cell
+				for event := range events {
+					switch e := event.(type) {
+					case gol.FinalTurnComplete:
+						cells = e.Alive
+					}
+				}
+				assertEqualBoard(t, cells, expectedAlive, p)
+
+				cellsFromImage := util.ReadPlacedAliveCells(fmt.Sprintf("out/%vx%vx%v.pgm", p.ImageWidth, p.ImageHeight, p.Turns))
+				assertEqualBoard(t, cellsFromImage, expectedAlive, p)
+			})
+		}
+	}
+}
+
+func readCellsCsv(path string) []util.Cell {
+	f, err := os.Open(path)
+	util.Check(err)
+	defer f.Close()
+	table, err := csv.NewReader(f).ReadAll()
+	util.Check(err)
+	var cells []util.Cell
+	for _, row := range table[1:] {
+		x, err := strconv.Atoi(row[0])
+		util.Check(err)
+		y, err := strconv.Atoi(row[1])
+		util.Check(err)
+		cells = append(cells, util.Cell{X: x, Y: y})
+	}
+	return cells
+}
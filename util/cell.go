@@ -1,56 +1,46 @@
 package util
 
-import (
-	"io/ioutil"
-	"strconv"
-	"strings"
-)
+import "fmt"
 
 // Cell is used as the return type for the testing framework.
 type Cell struct {
 	X, Y int
 }
 
+// ReadAliveCells returns the alive (255) cells of a pbm, pgm, png or jpeg image.
 func ReadAliveCells(path string, width, height int) []Cell {
-	//data, ioError := ioutil.ReadFile("check/images/" + fmt.Sprintf("%vx%vx%v.pgm", width, height, turns))
-	data, ioError := ioutil.ReadFile(path)
-	Check(ioError)
-
-	fields := strings.Fields(string(data))
-
-	if fields[0] != "P5" {
-		panic("Not a pgm file")
-	}
+	return readCells(path, width, height, func(b byte) bool { return b == 255 })
+}
 
-	imageWidth, _ := strconv.Atoi(fields[1])
-	if imageWidth != width {
-		panic("Incorrect width")
-	}
+// ReadDyingCells returns the cells of a pgm image that are neither alive (255) nor dead (0),
+// i.e. the refractory cells of a Generations rule.
+func ReadDyingCells(path string, width, height int) []Cell {
+	return readCells(path, width, height, func(b byte) bool { return b != 255 && b != 0 })
+}
 
-	imageHeight, _ := strconv.Atoi(fields[2])
-	if imageHeight != height {
-		panic("Incorrect height")
+// readCells returns the cells of an image whose pixel matches, checking that the image is width x height.
+// An image scaled up by a whole number, with every cell drawn as a square of pixels, is read at its scale.
+func readCells(path string, width, height int, match func(byte) bool) []Cell {
+	header, image := readImageFile(path)
+	scale := 1
+	if width > 0 && header.Width%width == 0 {
+		scale = header.Width / width
 	}
-
-	maxval, _ := strconv.Atoi(fields[3])
-	if maxval != 255 {
-		panic("Incorrect maxval/bit depth")
+	if header.Width != width*scale || header.Height != height*scale {
+		Check(fmt.Errorf("%v is %vx%v, not %vx%v", path, header.Width, header.Height, width, height))
 	}
 
-	image := []byte(fields[4])
-
 	var cells []Cell
 	for y := 0; y < height; y++ {
 		for x := 0; x < width; x++ {
-			cell := image[0]
-			if cell != 0 {
+			cell := image[y*scale*header.Width+x*scale]
+			if match(cell) {
 				cells = append(cells, Cell{
 					X: x,
 					Y: y,
 				})
 			}
-			image = image[1:]
 		}
 	}
 	return cells
-}
\ No newline at end of file
+}
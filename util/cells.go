@@ -0,0 +1,81 @@
+package util
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ReadPlaintext reads a pattern in LifeWiki's plaintext (.cells) format:
+//
+//	!Name: Glider
+//	!A comment
+//	.O
+//	..O
+//	OOO
+//
+// . is a dead cell and O an alive cell. Rows may be shorter than the widest row, the missing cells are dead.
+// A "!Name:" line sets the name of the pattern and the other lines starting with ! its comments.
+func ReadPlaintext(r io.Reader) (Pattern, error) {
+	var p Pattern
+	var rows []string
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		switch {
+		case strings.HasPrefix(line, "!Name:"):
+			p.Name = strings.TrimSpace(line[len("!Name:"):])
+		case strings.HasPrefix(line, "!"):
+			p.Comments = append(p.Comments, strings.TrimSpace(line[1:]))
+		default:
+			rows = append(rows, line)
+			if len(line) > p.Width {
+				p.Width = len(line)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return p, err
+	}
+
+	p.Height = len(rows)
+	p.Cells = make([]uint8, p.Width*p.Height)
+	for y, row := range rows {
+		for x, b := range []byte(row) {
+			switch b {
+			case '.':
+			case 'O', '*':
+				p.Cells[y*p.Width+x] = 1
+			default:
+				return p, fmt.Errorf("invalid character %q in row %v", b, y)
+			}
+		}
+	}
+	return p, nil
+}
+
+// WritePlaintext writes a pattern in LifeWiki's plaintext (.cells) format. Every row is written in full so that
+// the size of the pattern is kept. The format only has two states, so the dying cells of Generations rules are written as dead.
+func WritePlaintext(w io.Writer, p Pattern) error {
+	out := bufio.NewWriter(w)
+	if p.Name != "" {
+		fmt.Fprintf(out, "!Name: %v\n", p.Name)
+	}
+	for _, comment := range p.Comments {
+		fmt.Fprintf(out, "!%v\n", comment)
+	}
+	row := make([]byte, p.Width+1)
+	row[p.Width] = '\n'
+	for y := 0; y < p.Height; y++ {
+		for x := 0; x < p.Width; x++ {
+			row[x] = '.'
+			if p.Get(x, y) == 1 {
+				row[x] = 'O'
+			}
+		}
+		out.Write(row)
+	}
+	return out.Flush()
+}
@@ -0,0 +1,198 @@
+package util
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"strings"
+)
+
+// life105LineLength is the length of the lines of a Life 1.05 file, which may not exceed 80 characters.
+const life105LineLength = 80
+
+// ReadLife105 reads a pattern in the Life 1.05 format:
+//
+//	#Life 1.05
+//	#D A comment
+//	#N
+//	#P -1 -1
+//	.*
+//	..*
+//	***
+//
+// "#D" lines are comments, "#N" selects Conway's rule and "#R 23/3" another rule in S/B notation.
+// Every "#P x y" line starts a block of rows of . (dead) and * (alive) cells with its top left cell at (x, y).
+// The pattern covers every block and its origin is the top left cell of that rectangle.
+func ReadLife105(r io.Reader) (Pattern, error) {
+	var p Pattern
+	scanner := bufio.NewScanner(r)
+	if !scanner.Scan() || !strings.HasPrefix(scanner.Text(), "#Life 1.05") {
+		return p, errors.New("no #Life 1.05 header")
+	}
+
+	alive := make(map[image.Point]bool)
+	var bounds image.Rectangle
+	block := image.Point{}
+	y := 0
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		switch {
+		case strings.HasPrefix(line, "#D"):
+			p.Comments = append(p.Comments, strings.TrimSpace(line[2:]))
+		case strings.HasPrefix(line, "#N"):
+			p.Rule = "B3/S23"
+		case strings.HasPrefix(line, "#R"):
+			p.Rule = strings.TrimSpace(line[2:])
+		case strings.HasPrefix(line, "#P"):
+			if n, _ := fmt.Sscanf(line, "#P %d %d", &block.X, &block.Y); n != 2 {
+				return p, fmt.Errorf("invalid block %q", line)
+			}
+			if err := checkLifePoint(block); err != nil {
+				return p, err
+			}
+			y = 0
+		case strings.HasPrefix(line, "#"):
+		default:
+			for x, b := range []byte(line) {
+				switch b {
+				case '.':
+				case '*':
+					alive[block.Add(image.Pt(x, y))] = true
+				default:
+					return p, fmt.Errorf("invalid character %q in a block at %v", b, block)
+				}
+			}
+			bounds = bounds.Union(image.Rect(0, 0, len(line), 1).Add(block.Add(image.Pt(0, y))))
+			y++
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return p, err
+	}
+	return placedPattern(p, bounds, alive)
+}
+
+// ReadLife106 reads a pattern in the Life 1.06 format, a "#Life 1.06" header followed by the coordinates
+// of one alive cell per line:
+//
+//	#Life 1.06
+//	0 -1
+//	1 0
+//	-1 1
+//	0 1
+//	1 1
+//
+// The pattern covers the alive cells and its origin is the top left cell of that rectangle.
+func ReadLife106(r io.Reader) (Pattern, error) {
+	var p Pattern
+	scanner := bufio.NewScanner(r)
+	if !scanner.Scan() || !strings.HasPrefix(scanner.Text(), "#Life 1.06") {
+		return p, errors.New("no #Life 1.06 header")
+	}
+
+	alive := make(map[image.Point]bool)
+	var bounds image.Rectangle
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		var cell image.Point
+		if n, _ := fmt.Sscanf(line, "%d %d", &cell.X, &cell.Y); n != 2 {
+			return p, fmt.Errorf("invalid cell %q", line)
+		}
+		if err := checkLifePoint(cell); err != nil {
+			return p, err
+		}
+		alive[cell] = true
+		bounds = bounds.Union(image.Rectangle{cell, cell.Add(image.Pt(1, 1))})
+	}
+	if err := scanner.Err(); err != nil {
+		return p, err
+	}
+	return placedPattern(p, bounds, alive)
+}
+
+// maxLifeCoordinate is the largest distance of a cell or block from the origin, far enough to hold any pattern
+// of maxPatternCells but near enough that the size of the bounding box cannot overflow.
+const maxLifeCoordinate = maxPatternCells
+
+// checkLifePoint returns an error if a cell or block lies further than maxLifeCoordinate from the origin.
+func checkLifePoint(point image.Point) error {
+	if point.X < -maxLifeCoordinate || point.X > maxLifeCoordinate || point.Y < -maxLifeCoordinate || point.Y > maxLifeCoordinate {
+		return fmt.Errorf("%v is too far from the origin", point)
+	}
+	return nil
+}
+
+// placedPattern fills in the cells of a pattern covering bounds, given its alive cells.
+// The cells are stored densely, so bounds larger than maxPatternCells are an error however few cells are alive.
+func placedPattern(p Pattern, bounds image.Rectangle, alive map[image.Point]bool) (Pattern, error) {
+	if err := CheckPatternSize(bounds.Dx(), bounds.Dy()); err != nil {
+		return p, fmt.Errorf("the cells span %v: %v", bounds, err)
+	}
+	p.Width, p.Height = bounds.Dx(), bounds.Dy()
+	p.Origin = bounds.Min
+	p.Positioned = true
+	p.Cells = make([]uint8, p.Width*p.Height)
+	for cell := range alive {
+		cell = cell.Sub(bounds.Min)
+		p.Cells[cell.Y*p.Width+cell.X] = 1
+	}
+	return p, nil
+}
+
+// WriteLife105 writes a pattern in the Life 1.05 format. The name and comments are written as "#D" lines
+// and the rule as a "#R" line, or "#N" for Conway's rule. Every row is written in full, in blocks of at most
+// 80 columns, so that the size of the pattern is kept. Dying cells of Generations rules are written as dead.
+func WriteLife105(w io.Writer, p Pattern) error {
+	out := bufio.NewWriter(w)
+	fmt.Fprintln(out, "#Life 1.05")
+	if p.Name != "" {
+		fmt.Fprintf(out, "#D %v\n", p.Name)
+	}
+	for _, comment := range p.Comments {
+		fmt.Fprintf(out, "#D %v\n", comment)
+	}
+	if p.Rule == "" || p.Rule == "B3/S23" {
+		fmt.Fprintln(out, "#N")
+	} else {
+		fmt.Fprintf(out, "#R %v\n", p.Rule)
+	}
+	for left := 0; left < p.Width; left += life105LineLength {
+		right := left + life105LineLength
+		if right > p.Width {
+			right = p.Width
+		}
+		fmt.Fprintf(out, "#P %d %d\n", p.Origin.X+left, p.Origin.Y)
+		row := make([]byte, right-left+1)
+		row[right-left] = '\n'
+		for y := 0; y < p.Height; y++ {
+			for x := left; x < right; x++ {
+				row[x-left] = '.'
+				if p.Get(x, y) == 1 {
+					row[x-left] = '*'
+				}
+			}
+			out.Write(row)
+		}
+	}
+	return out.Flush()
+}
+
+// WriteLife106 writes the alive cells of a pattern in the Life 1.06 format, offset by its origin.
+// The format records neither the size of the pattern nor its rule or comments.
+func WriteLife106(w io.Writer, p Pattern) error {
+	out := bufio.NewWriter(w)
+	fmt.Fprintln(out, "#Life 1.06")
+	for y := 0; y < p.Height; y++ {
+		for x := 0; x < p.Width; x++ {
+			if p.Get(x, y) == 1 {
+				fmt.Fprintf(out, "%d %d\n", p.Origin.X+x, p.Origin.Y+y)
+			}
+		}
+	}
+	return out.Flush()
+}
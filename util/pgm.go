@@ -0,0 +1,325 @@
+package util
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// maxPgmPixels is the largest number of pixels an image may declare, so that a corrupt header cannot overflow.
+const maxPgmPixels = 1 << 30
+
+// PgmHeader holds the header fields of a pbm (P1, P4) or pgm (P2, P5) file.
+// Magic is the format of the file, Maxval is 1 for a pbm file and otherwise up to 65535.
+// Origin is the position of the top left pixel on an unbounded board, (0,0) unless the file records one.
+// Comments holds the text of the other comments, without the leading '#'.
+type PgmHeader struct {
+	Magic                 string
+	Width, Height, Maxval int
+	Origin                image.Point
+	Comments              []string
+}
+
+// pgmReader reads the tokens of a pbm or pgm file, skipping whitespace and collecting the comments into its header.
+type pgmReader struct {
+	r      *bufio.Reader
+	header *PgmHeader
+}
+
+// skip skips whitespace and comments.
+func (p pgmReader) skip() error {
+	for {
+		b, err := p.r.ReadByte()
+		if err != nil {
+			return err
+		}
+		switch b {
+		case ' ', '\t', '\r', '\n', '\v', '\f':
+		case '#':
+			line, err := p.r.ReadString('\n')
+			if err != nil && err != io.EOF {
+				return err
+			}
+			var x, y int
+			if n, _ := fmt.Sscanf(line, " origin %d %d", &x, &y); n == 2 {
+				p.header.Origin = image.Pt(x, y)
+			} else {
+				p.header.Comments = append(p.header.Comments, strings.TrimSpace(line))
+			}
+		default:
+			return p.r.UnreadByte()
+		}
+	}
+}
+
+// token returns the next token, which ends at whitespace or a comment.
+func (p pgmReader) token() (string, error) {
+	if err := p.skip(); err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	for {
+		c, err := p.r.ReadByte()
+		if err == io.EOF {
+			return b.String(), nil
+		} else if err != nil {
+			return "", err
+		}
+		if c == '#' || c == ' ' || c == '\t' || c == '\r' || c == '\n' || c == '\v' || c == '\f' {
+			return b.String(), p.r.UnreadByte()
+		}
+		b.WriteByte(c)
+	}
+}
+
+// number returns the next token as a number of at most max.
+func (p pgmReader) number(name string, max int) (int, error) {
+	s, err := p.token()
+	if err != nil {
+		return 0, fmt.Errorf("truncated pgm header: no %v", name)
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 || n > max {
+		return 0, fmt.Errorf("invalid %v %q", name, s)
+	}
+	return n, nil
+}
+
+// ReadPgm reads a pbm (P1, P4) or pgm (P2, P5) image and returns its header and one byte per pixel.
+// The pixels of a pgm image with a maxval other than 255, such as a 16-bit image, are scaled to 0-255 and rounded,
+// so that only pixels at least halfway between the last two grey levels are alive (255).
+// A 1 in a pbm image, which is black, is an alive cell and written as 255.
+// The header may hold comments between any of its fields, and "# origin x y" comments set the origin.
+func ReadPgm(r io.Reader) (PgmHeader, []byte, error) {
+	var header PgmHeader
+	p := pgmReader{bufio.NewReader(r), &header}
+
+	magic := make([]byte, 2)
+	if _, err := io.ReadFull(p.r, magic); err != nil || magic[0] != 'P' || !strings.Contains("1245", string(magic[1])) {
+		return header, nil, errors.New("not a pbm or pgm file")
+	}
+	header.Magic = string(magic)
+	var err error
+	if header.Width, err = p.number("width", maxPgmPixels); err != nil {
+		return header, nil, err
+	}
+	if header.Height, err = p.number("height", maxPgmPixels); err != nil {
+		return header, nil, err
+	}
+	if header.Width > 0 && header.Height > maxPgmPixels/header.Width {
+		return header, nil, fmt.Errorf("%vx%v image is too large", header.Width, header.Height)
+	}
+	header.Maxval = 1
+	if header.Magic == "P2" || header.Magic == "P5" {
+		if header.Maxval, err = p.number("maxval", 65535); err != nil {
+			return header, nil, err
+		}
+		if header.Maxval == 0 {
+			return header, nil, errors.New("invalid maxval 0")
+		}
+	}
+
+	size := header.Width * header.Height
+	// The pixels are only allocated as they are read, so that a header claiming a huge image does not exhaust memory.
+	pixels := make([]byte, 0, minInt(size, 1<<16))
+	scale := func(value int) (byte, error) {
+		if value > header.Maxval {
+			return 0, fmt.Errorf("pixel %v is above the maxval %v", value, header.Maxval)
+		}
+		if header.Maxval == 1 {
+			return byte(value * 255), nil
+		}
+		return byte((value*255 + header.Maxval/2) / header.Maxval), nil
+	}
+
+	switch header.Magic {
+	case "P1":
+		// The digits of a plain pbm image need not be separated by whitespace.
+		for len(pixels) < size {
+			if err := p.skip(); err != nil {
+				return header, nil, errors.New("truncated pbm raster")
+			}
+			b, _ := p.r.ReadByte()
+			if b != '0' && b != '1' {
+				return header, nil, fmt.Errorf("invalid pbm pixel %q", b)
+			}
+			pixels = append(pixels, (b-'0')*255)
+		}
+	case "P2":
+		for len(pixels) < size {
+			value, err := p.number("pixel", 65535)
+			if err != nil {
+				return header, nil, err
+			}
+			pixel, err := scale(value)
+			if err != nil {
+				return header, nil, err
+			}
+			pixels = append(pixels, pixel)
+		}
+	case "P4", "P5":
+		// A single whitespace character separates the header from the raster.
+		if b, err := p.r.ReadByte(); err != nil || !strings.ContainsRune(" \t\r\n\v\f", rune(b)) {
+			return header, nil, errors.New("no whitespace before the raster")
+		}
+		bytesPerPixel := 1
+		if header.Maxval > 255 {
+			bytesPerPixel = 2
+		}
+		if header.Magic == "P4" {
+			// Every row of a binary pbm image is padded to a whole byte, with the leftmost pixel in the highest bit.
+			row := make([]byte, (header.Width+7)/8)
+			for y := 0; y < header.Height; y++ {
+				if _, err := io.ReadFull(p.r, row); err != nil {
+					return header, nil, errors.New("truncated pbm raster")
+				}
+				for x := 0; x < header.Width; x++ {
+					pixels = append(pixels, (row[x/8]>>(7-uint(x%8))&1)*255)
+				}
+			}
+			break
+		}
+		sample := make([]byte, bytesPerPixel)
+		for len(pixels) < size {
+			if _, err := io.ReadFull(p.r, sample); err != nil {
+				return header, nil, errors.New("truncated pgm raster")
+			}
+			value := int(sample[0])
+			if bytesPerPixel == 2 {
+				value = value<<8 | int(sample[1])
+			}
+			pixel, err := scale(value)
+			if err != nil {
+				return header, nil, err
+			}
+			pixels = append(pixels, pixel)
+		}
+	}
+	return header, pixels, nil
+}
+
+// ParsePgm splits a pbm or pgm file into its header and pixels, as ReadPgm does.
+func ParsePgm(data []byte) (PgmHeader, []byte, error) {
+	return ReadPgm(bytes.NewReader(data))
+}
+
+// WritePgm writes one byte per pixel as an image in the format of header.Magic, a binary pgm (P5) if it is empty.
+// Pgm images have a maxval of 255 and in pbm images, pixels of at least 128 are written as 1.
+// The comments of the header are written first, followed by "# origin x y" if the origin is not (0,0).
+func WritePgm(w io.Writer, header PgmHeader, pixels []byte) error {
+	if len(pixels) != header.Width*header.Height {
+		return fmt.Errorf("%v pixels for a %vx%v image", len(pixels), header.Width, header.Height)
+	}
+	out := bufio.NewWriter(w)
+	magic := header.Magic
+	if magic == "" {
+		magic = "P5"
+	}
+	fmt.Fprintln(out, magic)
+	for _, comment := range header.Comments {
+		fmt.Fprintf(out, "# %v\n", comment)
+	}
+	if header.Origin != (image.Point{}) {
+		fmt.Fprintf(out, "# origin %d %d\n", header.Origin.X, header.Origin.Y)
+	}
+	fmt.Fprintf(out, "%d %d\n", header.Width, header.Height)
+
+	switch magic {
+	case "P1":
+		for y := 0; y < header.Height; y++ {
+			row := pixels[y*header.Width : (y+1)*header.Width]
+			for x, pixel := range row {
+				if x > 0 {
+					out.WriteByte(' ')
+				}
+				out.WriteByte('0' + pixel>>7)
+			}
+			out.WriteByte('\n')
+		}
+	case "P2":
+		fmt.Fprintln(out, 255)
+		for y := 0; y < header.Height; y++ {
+			row := pixels[y*header.Width : (y+1)*header.Width]
+			for x, pixel := range row {
+				if x > 0 {
+					out.WriteByte(' ')
+				}
+				out.WriteString(strconv.Itoa(int(pixel)))
+			}
+			out.WriteByte('\n')
+		}
+	case "P4":
+		row := make([]byte, (header.Width+7)/8)
+		for y := 0; y < header.Height; y++ {
+			for i := range row {
+				row[i] = 0
+			}
+			for x, pixel := range pixels[y*header.Width : (y+1)*header.Width] {
+				row[x/8] |= pixel >> 7 << (7 - uint(x%8))
+			}
+			out.Write(row)
+		}
+	case "P5":
+		fmt.Fprintln(out, 255)
+		out.Write(pixels)
+	default:
+		return fmt.Errorf("unknown pbm or pgm format %q", magic)
+	}
+	return out.Flush()
+}
+
+// ReadPlacedAliveCells returns the alive (255) cells of an image of any size,
+// offset by the origin recorded in the file.
+func ReadPlacedAliveCells(path string) []Cell {
+	header, image := readImageFile(path)
+
+	var cells []Cell
+	for y := 0; y < header.Height; y++ {
+		for x := 0; x < header.Width; x++ {
+			if image[y*header.Width+x] == 255 {
+				cells = append(cells, Cell{
+					X: header.Origin.X + x,
+					Y: header.Origin.Y + y,
+				})
+			}
+		}
+	}
+	return cells
+}
+
+// Uncompressed returns a reader of the contents of r, which are decompressed if they are gzipped.
+func Uncompressed(r io.Reader) (io.Reader, error) {
+	b := bufio.NewReader(r)
+	if magic, _ := b.Peek(2); bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		return gzip.NewReader(b)
+	}
+	return b, nil
+}
+
+// readImageFile reads the pbm, pgm, png or jpeg image at path, which may be gzipped.
+func readImageFile(path string) (PgmHeader, []byte) {
+	file, ioError := os.Open(path)
+	Check(ioError)
+	defer file.Close()
+	r, err := Uncompressed(file)
+	Check(err)
+	header, image, err := ReadImage(r)
+	if err != nil {
+		Check(fmt.Errorf("%v: %v", path, err))
+	}
+	return header, image
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
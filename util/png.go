@@ -0,0 +1,33 @@
+package util
+
+import (
+	"bufio"
+	"bytes"
+	"image"
+	"image/color"
+	_ "image/jpeg" // jpeg images are decoded by image.Decode
+	_ "image/png"  // png images are decoded by image.Decode
+	"io"
+)
+
+// ReadImage reads a pbm, pgm, png or jpeg image and returns its header and the grey level of every pixel,
+// which is the luminance of the pixels of png and jpeg images. The Magic of their header is "png" or "jpeg".
+func ReadImage(r io.Reader) (PgmHeader, []byte, error) {
+	b := bufio.NewReader(r)
+	if magic, _ := b.Peek(3); !bytes.Equal(magic, []byte("\x89PN")) && !bytes.Equal(magic, []byte("\xff\xd8\xff")) {
+		return ReadPgm(b)
+	}
+	m, format, err := image.Decode(b)
+	if err != nil {
+		return PgmHeader{}, nil, err
+	}
+	bounds := m.Bounds()
+	header := PgmHeader{Magic: format, Width: bounds.Dx(), Height: bounds.Dy(), Maxval: 255}
+	pixels := make([]byte, 0, header.Width*header.Height)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			pixels = append(pixels, color.GrayModel.Convert(m.At(x, y)).(color.Gray).Y)
+		}
+	}
+	return header, pixels, nil
+}
@@ -0,0 +1,283 @@
+package util
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Pattern is a rectangle of cells read from, or written to, a pattern file.
+// Cells holds the state of every cell row by row: 0 is dead, 1 is alive and 2 and above are the dying states of Generations rules.
+// Rule is the rule recorded in the file, possibly with a topology suffix such as :T64,64, or empty if there is none.
+// Positioned is true if the file records the position of the pattern, in which case Origin is the position of its top left cell.
+type Pattern struct {
+	Width, Height int
+	Cells         []uint8
+	Rule          string
+	Name          string
+	Comments      []string
+	Origin        image.Point
+	Positioned    bool
+}
+
+// Get returns the state of the cell at (x, y) of the pattern.
+func (p Pattern) Get(x, y int) uint8 {
+	return p.Cells[y*p.Width+x]
+}
+
+// rleLineLength is the length of the lines of an RLE file, which Golly and LifeWiki keep within 70 characters.
+const rleLineLength = 70
+
+// ReadRle reads a pattern in Golly's run length encoded format:
+//
+//	#N Glider
+//	#C A comment
+//	x = 3, y = 3, rule = B3/S23
+//	bo$2bo$3o!
+//
+// b and . are dead cells, o and A alive cells, and B to X and pA to yO the dying states of Generations rules.
+// Any other letter is an alive cell. $ ends a row and ! the pattern. The position of the pattern is read
+// from a "#CXRLE Pos=x,y" line, and "#N" and "#C" lines set its name and comments.
+func ReadRle(r io.Reader) (Pattern, error) {
+	var p Pattern
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1<<20)
+
+	// The comment lines and the header.
+	header := false
+	for !header && scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "":
+		case strings.HasPrefix(line, "#CXRLE"):
+			for _, field := range strings.Fields(line[len("#CXRLE"):]) {
+				if strings.HasPrefix(field, "Pos=") {
+					if n, _ := fmt.Sscanf(field, "Pos=%d,%d", &p.Origin.X, &p.Origin.Y); n != 2 {
+						return p, fmt.Errorf("invalid position %q", field)
+					}
+					p.Positioned = true
+				}
+			}
+		case strings.HasPrefix(line, "#N"):
+			p.Name = strings.TrimSpace(line[2:])
+		case strings.HasPrefix(line, "#C"), strings.HasPrefix(line, "#c"):
+			p.Comments = append(p.Comments, strings.TrimSpace(line[2:]))
+		case strings.HasPrefix(line, "#"):
+		default:
+			if err := p.parseRleHeader(line); err != nil {
+				return p, err
+			}
+			header = true
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return p, err
+	}
+	if !header {
+		return p, errors.New("no RLE header line, e.g. x = 3, y = 3")
+	}
+
+	if err := CheckPatternSize(p.Width, p.Height); err != nil {
+		return p, err
+	}
+
+	// The runs of cells.
+	p.Cells = make([]uint8, p.Width*p.Height)
+	x, y := 0, 0
+	count := ""
+	prefix := byte(0)
+	for scanner.Scan() {
+		line := scanner.Text()
+		for i := 0; i < len(line); i++ {
+			b := line[i]
+			if b == ' ' || b == '\t' || b == '\r' {
+				continue
+			}
+			if b >= '0' && b <= '9' {
+				count += string(b)
+				continue
+			}
+			n := 1
+			if count != "" {
+				var err error
+				if n, err = strconv.Atoi(count); err != nil || n < 1 {
+					return p, fmt.Errorf("invalid run count %q in row %v", count, y)
+				}
+				count = ""
+			}
+
+			var state int
+			switch {
+			case b == '!':
+				return p, nil
+			case b == '$':
+				if n > p.Height-y {
+					return p, fmt.Errorf("row %v of the pattern is beyond its %vx%v header", y+n, p.Width, p.Height)
+				}
+				x, y = 0, y+n
+				continue
+			case b >= 'p' && b <= 'y' && prefix == 0:
+				prefix = b
+				continue
+			case b >= 'A' && b <= 'X':
+				state = int(b-'A') + 1
+				if prefix != 0 {
+					state += 24 * int(prefix-'p'+1)
+					prefix = 0
+				}
+			case prefix != 0:
+				return p, fmt.Errorf("invalid state %c%c", prefix, b)
+			case b == 'b' || b == '.':
+				state = 0
+			case b >= 'a' && b <= 'z':
+				state = 1
+			default:
+				return p, fmt.Errorf("invalid character %q in row %v", b, y)
+			}
+			if state > 255 {
+				return p, fmt.Errorf("invalid state %v", state)
+			}
+			if n > p.Width-x || y >= p.Height {
+				return p, fmt.Errorf("row %v of the pattern does not fit in its %vx%v header", y, p.Width, p.Height)
+			}
+			for ; n > 0; n-- {
+				p.Cells[y*p.Width+x] = uint8(state)
+				x++
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return p, err
+	}
+	return p, errors.New("the pattern does not end with !")
+}
+
+// maxPatternCells is the largest number of cells a pattern file may cover, the same as the pixels of an image,
+// so that a corrupt or hostile size cannot exhaust the memory.
+const maxPatternCells = maxPgmPixels
+
+// CheckPatternSize returns an error if a pattern of width x height cells is larger than maxPatternCells.
+// It is also used for the images decoded into patterns, before decoding their pixels.
+func CheckPatternSize(width, height int) error {
+	if width < 0 || height < 0 || width > maxPatternCells || height > maxPatternCells ||
+		width > 0 && height > maxPatternCells/width {
+		return fmt.Errorf("%vx%v pattern is too large", width, height)
+	}
+	return nil
+}
+
+// parseRleHeader parses a header line such as "x = 3, y = 3, rule = B3/S23:T64,64".
+func (p *Pattern) parseRleHeader(line string) error {
+	for _, field := range strings.Split(line, ",") {
+		parts := strings.SplitN(field, "=", 2)
+		if len(parts) != 2 {
+			// The size of a topology suffix holds a comma too.
+			if p.Rule == "" {
+				return fmt.Errorf("invalid RLE header %q", line)
+			}
+			p.Rule += "," + strings.TrimSpace(field)
+			continue
+		}
+		key, value := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+		var err error
+		switch key {
+		case "x":
+			p.Width, err = strconv.Atoi(value)
+		case "y":
+			p.Height, err = strconv.Atoi(value)
+		case "rule":
+			p.Rule = value
+		}
+		if err != nil || p.Width < 0 || p.Height < 0 {
+			return fmt.Errorf("invalid RLE header %q", line)
+		}
+	}
+	return nil
+}
+
+// WriteRle writes a pattern in Golly's run length encoded format, with lines of at most 70 characters.
+// Two-state patterns use b and o, patterns with dying states . and A to X, followed by pA to yO.
+// The name, comments and rule are written if they are set, and the origin if the pattern is positioned.
+func WriteRle(w io.Writer, p Pattern) error {
+	out := bufio.NewWriter(w)
+	if p.Name != "" {
+		fmt.Fprintf(out, "#N %v\n", p.Name)
+	}
+	for _, comment := range p.Comments {
+		fmt.Fprintf(out, "#C %v\n", comment)
+	}
+	if p.Positioned {
+		fmt.Fprintf(out, "#CXRLE Pos=%d,%d\n", p.Origin.X, p.Origin.Y)
+	}
+	fmt.Fprintf(out, "x = %d, y = %d", p.Width, p.Height)
+	if p.Rule != "" {
+		fmt.Fprintf(out, ", rule = %v", p.Rule)
+	}
+	fmt.Fprintln(out)
+
+	multiState := false
+	for _, state := range p.Cells {
+		if state > 1 {
+			multiState = true
+		}
+	}
+	tag := func(state uint8) string {
+		switch {
+		case !multiState && state == 0:
+			return "b"
+		case !multiState:
+			return "o"
+		case state == 0:
+			return "."
+		case state <= 24:
+			return string(rune('A' + state - 1))
+		}
+		return string([]byte{byte('p' + (state-25)/24), byte('A' + (state-25)%24)})
+	}
+
+	// Runs are never split across lines.
+	column := 0
+	write := func(n int, symbol string) {
+		run := symbol
+		if n > 1 {
+			run = strconv.Itoa(n) + symbol
+		}
+		if column+len(run) > rleLineLength {
+			out.WriteString("\n")
+			column = 0
+		}
+		out.WriteString(run)
+		column += len(run)
+	}
+
+	// Dead cells at the end of a row and empty rows at the end of the pattern are left out.
+	row := 0
+	for y := 0; y < p.Height; y++ {
+		end := p.Width
+		for end > 0 && p.Get(end-1, y) == 0 {
+			end--
+		}
+		if end == 0 {
+			continue
+		}
+		if y > row {
+			write(y-row, "$")
+			row = y
+		}
+		for x := 0; x < end; {
+			n := 1
+			for x+n < end && p.Get(x+n, y) == p.Get(x, y) {
+				n++
+			}
+			write(n, tag(p.Get(x, y)))
+			x += n
+		}
+	}
+	write(1, "!")
+	out.WriteString("\n")
+	return out.Flush()
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// TestWorkerLost kills one of three worker processes part of the way through 100 turns of the 512x512 image,
+// with a spare worker process (2 strips) and without one (4 strips), and checks that the final board is still correct.
+func TestWorkerLost(t *testing.T) {
+	expectedAlive := util.ReadAliveCells("check/images/512x512x100.pgm", 512, 512)
+	for _, threads := range []int{2, 4} {
+		t.Run(fmt.Sprintf("512x512x100-%d", threads), func(t *testing.T) {
+			addresses, processes := startWorkerProcesses(3)
+			defer stopWorkerProcesses(processes)
+
+			p := gol.Params{
+				Turns:       100,
+				Threads:     threads,
+				ImageWidth:  512,
+				ImageHeight: 512,
+				Workers:     addresses,
+			}
+			events := make(chan gol.Event)
+			gol.Run(p, events, nil)
+
+			var cells []util.Cell
+			var lost, recovered []string
+			for event := range events {
+				switch e := event.(type) {
+				case gol.TurnComplete:
+					if e.CompletedTurns == 10 {
+						util.Check(processes[0].Process.Kill())
+					}
+				case gol.WorkerLost:
+					lost = append(lost, e.Worker)
+				case gol.WorkerRecovered:
+					recovered = append(recovered, e.Worker)
+				case gol.FinalTurnComplete:
+					cells = e.Alive
+				}
+			}
+			if len(lost) != 1 || lost[0] != addresses[0] {
+				t.Errorf("Expected a WorkerLost event for %v, got %v", addresses[0], lost)
+			}
+			if len(recovered) != 1 || recovered[0] != addresses[0] {
+				t.Errorf("Expected a WorkerRecovered event for %v, got %v", addresses[0], recovered)
+			}
+			assertEqualBoard(t, cells, expectedAlive, p)
+		})
+	}
+}
+
+// TestAllWorkersLost kills the only worker process part of the way through a run and checks that the run ends
+// with a RunFailed event and quits, rather than panicking.
+func TestAllWorkersLost(t *testing.T) {
+	addresses, processes := startWorkerProcesses(1)
+	defer stopWorkerProcesses(processes)
+
+	p := gol.Params{Turns: 100, Threads: 2, ImageWidth: 64, ImageHeight: 64, Workers: addresses}
+	defer os.Remove("out/64x64x100.checkpoint.pgm")
+	events := make(chan gol.Event)
+	gol.Run(p, events, nil)
+
+	var failed *gol.RunFailed
+	var last gol.Event
+	for event := range events {
+		switch e := event.(type) {
+		case gol.TurnComplete:
+			if e.CompletedTurns == 10 {
+				util.Check(processes[0].Process.Kill())
+			}
+		case gol.RunFailed:
+			failed = &e
+		case gol.ImageOutputComplete:
+			defer os.Remove("out/" + e.Filename + ".pgm")
+		}
+		last = event
+	}
+	if failed == nil || failed.CompletedTurns <= 10 || failed.CompletedTurns >= p.Turns {
+		t.Fatalf("Expected the run to fail once the worker process was lost, got %v", failed)
+	}
+	if last != (gol.StateChange{CompletedTurns: failed.CompletedTurns, NewState: gol.Quitting}) {
+		t.Errorf("Expected the run to quit at turn %v, the last event was %v", failed.CompletedTurns, last)
+	}
+}